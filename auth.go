@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	scopeRead  = "read"
+	scopeAdmin = "admin"
+)
+
+// APIKeys maps an api key to the scope it grants
+type APIKeys map[string]string
+
+// Add registers keys from a comma separated list
+func (k APIKeys) Add(list string, scope string) {
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			k[key] = scope
+		}
+	}
+}
+
+// LoadFile reads keys from a file with one "<scope> <key>" pair per line, blank lines and lines starting with # are skipped
+func (k APIKeys) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected \"<scope> <key>\"", path, line)
+		}
+
+		switch fields[0] {
+		case scopeRead, scopeAdmin:
+			k[fields[1]] = fields[0]
+		default:
+			return fmt.Errorf("%s:%d: unknown scope %s", path, line, fields[0])
+		}
+	}
+
+	return scanner.Err()
+}
+
+// scope returns the scope of a key, comparing in constant time
+func (k APIKeys) scope(key string) (string, bool) {
+	var found string
+	for candidate, scope := range k {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			found = scope
+		}
+	}
+
+	return found, found != ""
+}
+
+// requestKey pulls the api key from the Authorization bearer token or the X-API-Key header
+func requestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	return r.Header.Get("X-API-Key")
+}
+
+// readOnly reports if a request only looks at the manager
+func readOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// authenticate requires a read key to list bots and an admin key to change them.
+// Without any keys configured the api stays open, metrics are never protected.
+func (m *Manager) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(m.APIKeys) == 0 || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope, ok := m.APIKeys.scope(requestKey(r))
+		if !ok {
+			logger.Warnf("Rejected unauthenticated %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="discord-stock-ticker"`)
+			writeError(w, http.StatusUnauthorized, "A valid api key is required")
+			return
+		}
+
+		if scope != scopeAdmin && !readOnly(r) {
+			logger.Warnf("Rejected read only key for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			writeError(w, http.StatusForbidden, "This api key can only list bots")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,34 +2,39 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
-	"github.com/go-redis/redis/v8"
-
 	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
+var (
+	// default display formats of boards, the status ones are the activity of boards that do not set their nickname
+	boardNickname       = mustTemplate("{{.Header}}{{.Symbol}} {{.Decorator}} {{.FullPrice}}")
+	stockBoardActivity  = mustTemplate("{{if .AfterHours}}AHT{{else}}Change{{end}}: {{if .Percentage}}{{.FullPercent}}{{else}}{{.FullChange}}{{end}}")
+	cryptoBoardActivity = mustTemplate("24hr: {{if .Percentage}}{{.FullPercent}}{{else}}{{.FullChange}}{{end}}")
+	stockBoardStatus    = mustTemplate("{{.Symbol}} {{.Price}} {{if .AfterHours}}AHT {{if .Percentage}}{{.FullPercent}}{{else}}{{.Change}}{{end}}{{else}}{{.Decorator}} {{if .Percentage}}{{.FullPercent}}{{else}}{{.FullChange}}{{end}}{{end}}")
+	cryptoBoardStatus   = mustTemplate("{{.Symbol}} {{.FullPrice}} {{.Decorator}} {{if .Percentage}}{{.Percent}}{{else}}{{.Change}}{{end}}")
+)
+
 type Board struct {
-	Items      []string        `json:"items"`
-	Name       string          `json:"name"`
-	Header     string          `json:"header"`
-	Nickname   bool            `json:"nickname"`
-	Color      bool            `json:"color"`
-	Percentage bool            `json:"percentage"`
-	Arrows     bool            `json:"arrows"`
-	Frequency  time.Duration   `json:"frequency"`
-	Price      int             `json:"-"`
-	Cache      *redis.Client   `json:"-"`
-	Context    context.Context `json:"-"`
-	token      string          `json:"-"`
-	close      chan int        `json:"-"`
+	Items      []string           `json:"items"`
+	Crypto     bool               `json:"crypto"`
+	Name       string             `json:"name"`
+	Header     string             `json:"header"`
+	Nickname   bool               `json:"nickname"`
+	Color      bool               `json:"color"`
+	Percentage bool               `json:"percentage"`
+	Arrows     bool               `json:"arrows"`
+	Frequency  time.Duration      `json:"frequency"`
+	Format     utils.NumberFormat `json:"format"`
+	Decimals   int                `json:"decimals"`
+	Price      int                `json:"-"`
+	watcher
 }
 
-// NewBoard saves information about the board and starts up a watcher on it
-func NewStockBoard(items []string, token string, name string, header string, nickname bool, color bool, percentage bool, arrows bool, frequency int) *Board {
+// NewStockBoard saves information about the board to watch
+func NewStockBoard(items []string, token string, name string, header string, nickname bool, color bool, percentage bool, arrows bool, frequency int, format utils.NumberFormat) *Board {
 	b := &Board{
 		Items:      items,
 		Name:       name,
@@ -39,19 +44,19 @@ func NewStockBoard(items []string, token string, name string, header string, nic
 		Percentage: percentage,
 		Arrows:     arrows,
 		Frequency:  time.Duration(frequency) * time.Second,
-		token:      token,
-		close:      make(chan int, 1),
+		Format:     format,
+		Decimals:   format.Decimals,
+		watcher:    newWatcher(token),
 	}
 
-	// spin off go routine to watch the price
-	go b.watchStockPrice()
 	return b
 }
 
-// NewCrypto saves information about the crypto and starts up a watcher on it
-func NewCryptoBoard(items []string, token string, name string, header string, nickname bool, color bool, percentage bool, arrows bool, frequency int, cache *redis.Client, context context.Context) *Board {
+// NewCryptoBoard saves information about the board to watch
+func NewCryptoBoard(items []string, token string, name string, header string, nickname bool, color bool, percentage bool, arrows bool, frequency int, format utils.NumberFormat) *Board {
 	b := &Board{
 		Items:      items,
+		Crypto:     true,
 		Name:       name,
 		Header:     header,
 		Nickname:   nickname,
@@ -59,103 +64,113 @@ func NewCryptoBoard(items []string, token string, name string, header string, ni
 		Percentage: percentage,
 		Arrows:     arrows,
 		Frequency:  time.Duration(frequency) * time.Second,
-		Cache:      cache,
-		Context:    context,
-		token:      token,
-		close:      make(chan int, 1),
+		Format:     format,
+		Decimals:   format.Decimals,
+		watcher:    newWatcher(token),
 	}
 
-	// spin off go routine to watch the price
-	go b.watchCryptoPrice()
 	return b
 }
 
-// Shutdown sends a signal to shut off the goroutine
-func (b *Board) Shutdown() {
-	b.close <- 1
+// Start spins off a go routine to watch the prices
+func (b *Board) Start(ctx context.Context) {
+	b.begin(ctx)
+	if b.Crypto {
+		go b.watchCryptoPrice()
+		return
+	}
+	go b.watchStockPrice()
 }
 
-func (b *Board) watchStockPrice() {
+// Update changes the settings of the running board without reconnecting to discord
+func (b *Board) Update(req Request) error {
+	boardReq := req.(*BoardRequest)
+	old := b.request.(*BoardRequest)
 
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + b.token)
-	if err != nil {
-		fmt.Println("Error creating Discord session: ", err)
-		return
+	if old.Token != boardReq.Token || old.Crypto != boardReq.Crypto {
+		return errRestartRequired
 	}
 
-	// show as online
-	err = dg.Open()
-	if err != nil {
-		fmt.Println("error opening discord connection,", err)
-		return
-	}
+	return b.sendUpdate(boardReq)
+}
+
+// apply copies the settings that can change on the fly from a request, it is only called from the watching goroutine
+func (b *Board) apply(req *BoardRequest) {
+	b.Items = req.Items
+	b.Header = req.Header
+	b.Nickname = req.Nickname
+	b.Color = req.Color
+	b.Percentage = req.Percentage
+	b.Arrows = req.Arrows
+	b.Frequency = time.Duration(req.Frequency) * time.Second
+	b.Format = req.format()
+	b.Decimals = b.Format.Decimals
+	b.setTemplates(req.NicknameTemplate, req.ActivityTemplate)
+}
 
-	// get bot id
-	botUser, err := dg.User("@me")
+// quote fetches the price of a symbol from a provider, giving up when the board is stopped
+func (b *Board) quote(provider string, symbol string) (utils.Quote, error) {
+	p, err := utils.GetProvider(provider)
 	if err != nil {
-		fmt.Println("Error getting bot id: ", err)
-		return
+		return utils.Quote{}, err
 	}
 
-	// Get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
+	return p.GetQuote(b.ctx, symbol)
+}
+
+func (b *Board) watchStockPrice() {
+	defer b.exit()
+
+	dg, botUser, err := b.connect()
 	if err != nil {
-		fmt.Println("Error getting guilds: ", err)
-		b.Nickname = false
+		logger.Errorf("Connecting to discord for %s: %s", b.Name, err)
+		return
 	}
 
 	ticker := time.NewTicker(b.Frequency)
 
-	// continuously watch
-	for _, symbol := range b.Items {
+	// continuously watch, rotating through the items
+	itr := 0
+	for {
 		select {
-		case <-b.close:
+		case <-b.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", b.Name)
 			return
+		case u := <-b.update:
+			b.apply(u.request.(*BoardRequest))
+			ticker.Reset(b.Frequency)
+
+			logger.Infof("Updated settings for %s", b.Name)
+			close(u.applied)
 		case <-ticker.C:
+			if len(b.Items) == 0 {
+				continue
+			}
+			symbol := b.Items[itr%len(b.Items)]
+			itr++
 
 			logger.Infof("Fetching stock price for %s", symbol)
 
-			var priceData utils.PriceResults
 			var fmtPrice string
 			var fmtDiff string
 
-			// save the price struct & do something with it
-			priceData, err = utils.GetStockPrice(symbol)
+			// save the quote & do something with it
+			quote, err := b.quote("yahoo", symbol)
 			if err != nil {
-				logger.Errorf("Unable to fetch stock price for %s", symbol)
-			}
-
-			if len(priceData.QuoteSummary.Results) == 0 {
-				logger.Errorf("Yahoo returned bad data for %s", symbol)
+				logger.Errorf("Unable to fetch stock price for %s: %s", symbol, err)
 				continue
 			}
-			fmtPrice = priceData.QuoteSummary.Results[0].Price.RegularMarketPrice.Fmt
-
-			var activityHeader string
-
-			if b.Percentage {
-				activityHeader = ""
-			} else {
-				activityHeader = "$"
-			}
+			format := b.Format.WithDecimals(2)
+			fmtPrice = format.Format(quote.Price)
+			fmtPercent := b.Format.Fixed(2).Format(quote.ChangePercent)
 
 			// check for day or after hours change
-			var emptyChange utils.Change
+			afterHours := quote.MarketState == "PRE" || quote.MarketState == "POST"
 
-			if priceData.QuoteSummary.Results[0].Price.PostMarketChange != emptyChange {
-				if b.Percentage {
-					fmtDiff = priceData.QuoteSummary.Results[0].Price.PostMarketChangePercent.Fmt
-				} else {
-					fmtDiff = priceData.QuoteSummary.Results[0].Price.PostMarketChange.Fmt
-				}
+			if b.Percentage {
+				fmtDiff = fmtPercent
 			} else {
-				if b.Percentage {
-					fmtDiff = priceData.QuoteSummary.Results[0].Price.RegularMarketChangePercent.Fmt
-				} else {
-					fmtDiff = priceData.QuoteSummary.Results[0].Price.RegularMarketChange.Fmt
-				}
+				fmtDiff = format.Format(quote.Change)
 			}
 
 			// calculate if price has moved up or down
@@ -177,28 +192,40 @@ func (b *Board) watchStockPrice() {
 				decorator = "-"
 			}
 
+			display := Display{
+				Name:           b.Name,
+				Symbol:         strings.ToUpper(symbol),
+				Price:          fmtPrice,
+				Change:         format.Format(quote.Change),
+				Percent:        fmtPercent,
+				CurrencySymbol: "$",
+				FullPrice:      b.Format.Money(fmtPrice, "$"),
+				FullChange:     b.Format.Money(format.Format(quote.Change), "$"),
+				FullPercent:    b.Format.Percent(fmtPercent),
+				Decorator:      decorator,
+				Increase:       increase,
+				MarketState:    quote.MarketState,
+				AfterHours:     afterHours,
+				Volume:         fmtVolume(quote.Volume),
+				Header:         b.Header,
+				Percentage:     b.Percentage,
+				Quote:          quote,
+			}.withNumbers(format, quote.Price, quote.Change)
+
 			if b.Nickname {
 				// update nickname instead of activity
 				var nickname string
 				var activity string
 
-				displayName := b.Header + strings.ToUpper(symbol)
-
-				// format nickname
-				nickname = fmt.Sprintf("%s %s $%s", displayName, decorator, fmtPrice)
-
-				// format activity based on trading time
-				if priceData.QuoteSummary.Results[0].Price.PostMarketChange == emptyChange {
-					activity = fmt.Sprintf("Change: %s%s", activityHeader, fmtDiff)
-				} else {
-					activity = fmt.Sprintf("AHT: %s%s", activityHeader, fmtDiff)
-				}
+				// format nickname & activity
+				nickname = b.nickname(boardNickname, display)
+				activity = b.activity(stockBoardActivity, display)
 
 				// Update nickname in guilds
-				for _, g := range guilds {
+				for _, g := range b.guildList() {
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
-						fmt.Println("Error updating nickname: ", err)
+						logger.Errorf("Updating nickname: %s", err)
 						continue
 					}
 					logger.Infof("Set nickname in %s: %s", g.Name, nickname)
@@ -210,7 +237,7 @@ func (b *Board) watchStockPrice() {
 
 						roles, err := dg.GuildRoles(g.ID)
 						if err != nil {
-							fmt.Println("Error getting guilds: ", err)
+							logger.Errorf("Getting guilds: %s", err)
 							continue
 						}
 
@@ -251,7 +278,7 @@ func (b *Board) watchStockPrice() {
 					}
 				}
 
-				err = dg.UpdateGameStatus(0, b.Name)
+				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
 					logger.Error("Unable to set activity: ", err)
 				} else {
@@ -259,14 +286,8 @@ func (b *Board) watchStockPrice() {
 				}
 
 			} else {
-				var activity string
-
 				// format activity based on trading time
-				if priceData.QuoteSummary.Results[0].Price.PostMarketChange != emptyChange {
-					activity = fmt.Sprintf("%s %s AHT %s", symbol, fmtPrice, fmtDiff)
-				} else {
-					activity = fmt.Sprintf("%s %s %s $%s", symbol, fmtPrice, decorator, fmtDiff)
-				}
+				activity := b.activity(stockBoardStatus, display)
 
 				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
@@ -280,87 +301,64 @@ func (b *Board) watchStockPrice() {
 }
 
 func (b *Board) watchCryptoPrice() {
-	var rdb *redis.Client
-
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + b.token)
-	if err != nil {
-		fmt.Println("Error creating Discord session: ", err)
-		return
-	}
-
-	// show as online
-	err = dg.Open()
-	if err != nil {
-		fmt.Println("error opening discord connection,", err)
-		return
-	}
+	defer b.exit()
 
-	// get bot id
-	botUser, err := dg.User("@me")
+	dg, botUser, err := b.connect()
 	if err != nil {
-		fmt.Println("Error getting bot id: ", err)
+		logger.Errorf("Connecting to discord for %s: %s", b.Name, err)
 		return
 	}
 
-	// Get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
-	if err != nil {
-		fmt.Println("Error getting guilds: ", err)
-		b.Nickname = false
-	}
-
 	ticker := time.NewTicker(b.Frequency)
 	logger.Debugf("Watching crypto price for %s", b.Name)
 
-	// continuously watch
-	for _, symbol := range b.Items {
+	// continuously watch, rotating through the items
+	itr := 0
+	for {
 		select {
-		case <-b.close:
+		case <-b.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", b.Name)
 			return
+		case u := <-b.update:
+			b.apply(u.request.(*BoardRequest))
+			ticker.Reset(b.Frequency)
+
+			logger.Infof("Updated settings for %s", b.Name)
+			close(u.applied)
 		case <-ticker.C:
+			if len(b.Items) == 0 {
+				continue
+			}
+			symbol := b.Items[itr%len(b.Items)]
+			itr++
 
 			logger.Debugf("Fetching crypto price for %s", symbol)
 
-			var priceData utils.GeckoPriceResults
 			var fmtPrice string
 			var fmtDiff string
 
-			// save the price struct & do something with it
-			if b.Cache == rdb {
-				priceData, err = utils.GetCryptoPrice(symbol)
-			} else {
-				priceData, err = utils.GetCryptoPriceCache(b.Cache, b.Context, symbol)
-			}
+			// save the quote & do something with it
+			quote, err := b.quote("coingecko", symbol)
 			if err != nil {
-				logger.Errorf("Unable to fetch stock price for %s: %s", symbol, err)
+				logger.Errorf("Unable to fetch crypto price for %s: %s", symbol, err)
+				continue
 			}
 
-			var change float64
-			var activityHeader string
-			var activityFooter string
-
-			if b.Percentage {
-				change = priceData.MarketData.PriceChangePercent
-				activityHeader = ""
-				activityFooter = "%"
-			} else {
-				change = priceData.MarketData.CurrentPrice.USD
-				activityHeader = "$"
-				activityFooter = ""
+			// Check for cryptos below 1c
+			precision := 2
+			if quote.Price < 0.01 {
+				precision = 4
+			} else if quote.Price < 1.0 {
+				precision = 3
 			}
+			format := b.Format.WithDecimals(precision)
+			fmtPrice = format.Format(quote.Price)
+			fmtChange := format.Format(quote.Change)
+			fmtPercent := b.Format.Fixed(precision).Format(quote.ChangePercent)
 
-			// Check for cryptos below 1c
-			if priceData.MarketData.CurrentPrice.USD < 0.01 {
-				fmtPrice = fmt.Sprintf("%.4f", priceData.MarketData.CurrentPrice.USD)
-				fmtDiff = fmt.Sprintf("%.4f", change)
-			} else if priceData.MarketData.CurrentPrice.USD < 1.0 {
-				fmtPrice = fmt.Sprintf("%.3f", priceData.MarketData.CurrentPrice.USD)
-				fmtDiff = fmt.Sprintf("%.3f", change)
-			} else {
-				fmtPrice = fmt.Sprintf("%.2f", priceData.MarketData.CurrentPrice.USD)
-				fmtDiff = fmt.Sprintf("%.2f", change)
+			fmtDiff = fmtChange
+			if b.Percentage {
+				fmtDiff = fmtPercent
 			}
 
 			// calculate if price has moved up or down
@@ -382,24 +380,38 @@ func (b *Board) watchCryptoPrice() {
 				decorator = "-"
 			}
 
+			display := Display{
+				Name:           b.Name,
+				Symbol:         quote.Symbol,
+				Price:          fmtPrice,
+				Change:         fmtChange,
+				Percent:        fmtPercent,
+				CurrencySymbol: "$",
+				FullPrice:      b.Format.Money(fmtPrice, "$"),
+				FullChange:     b.Format.Money(fmtChange, "$"),
+				FullPercent:    b.Format.Percent(fmtPercent),
+				Decorator:      decorator,
+				Increase:       increase,
+				Volume:         fmtVolume(quote.Volume),
+				Header:         b.Header,
+				Percentage:     b.Percentage,
+				Quote:          quote,
+			}.withNumbers(format, quote.Price, quote.Change)
+
 			if b.Nickname {
 				// update nickname instead of activity
 				var nickname string
 				var activity string
 
-				displayName := b.Header + strings.ToUpper(priceData.Symbol)
-
-				// format nickname
-				nickname = fmt.Sprintf("%s %s $%s", displayName, decorator, fmtPrice)
-
-				// format activity
-				activity = fmt.Sprintf("24hr: %s%s%s", activityHeader, fmtDiff, activityFooter)
+				// format nickname & activity
+				nickname = b.nickname(boardNickname, display)
+				activity = b.activity(cryptoBoardActivity, display)
 
 				// Update nickname in guilds
-				for _, g := range guilds {
+				for _, g := range b.guildList() {
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
-						fmt.Println("Error updating nickname: ", err)
+						logger.Errorf("Updating nickname: %s", err)
 						continue
 					}
 					logger.Infof("Set nickname in %s: %s", g.Name, nickname)
@@ -411,7 +423,7 @@ func (b *Board) watchCryptoPrice() {
 
 						roles, err := dg.GuildRoles(g.ID)
 						if err != nil {
-							fmt.Println("Error getting guilds: ", err)
+							logger.Errorf("Getting guilds: %s", err)
 							continue
 						}
 
@@ -452,7 +464,7 @@ func (b *Board) watchCryptoPrice() {
 					}
 				}
 
-				err = dg.UpdateGameStatus(0, b.Name)
+				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
 					logger.Error("Unable to set activity: ", err)
 				} else {
@@ -462,7 +474,7 @@ func (b *Board) watchCryptoPrice() {
 			} else {
 
 				// format activity
-				activity := fmt.Sprintf("%s $%s %s %s", strings.ToUpper(priceData.Symbol), fmtPrice, decorator, fmtDiff)
+				activity := b.activity(cryptoBoardStatus, display)
 				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
 					logger.Error("Unable to set activity: ", err)
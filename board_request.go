@@ -1,150 +1,95 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"strings"
 
-	"github.com/gorilla/mux"
+	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
 // BoardRequest represents the json coming in from the request
 type BoardRequest struct {
-	Items      []string `json:"items"`
-	Token      string   `json:"discord_bot_token"`
-	Name       string   `json:"name"`
-	Header     string   `json:"header"`
-	Nickname   bool     `json:"set_nickname"`
-	Crypto     bool     `json:"crypto"`
-	Color      bool     `json:"set_color"`
-	Percentage bool     `json:"percentage"`
-	Arrows     bool     `json:"arrows"`
-	Frequency  int      `json:"frequency"`
+	Items               []string `json:"items"`
+	Token               string   `json:"discord_bot_token"`
+	Name                string   `json:"name"`
+	Header              string   `json:"header"`
+	Nickname            bool     `json:"set_nickname"`
+	Crypto              bool     `json:"crypto"`
+	Color               bool     `json:"set_color"`
+	Percentage          bool     `json:"percentage"`
+	Arrows              bool     `json:"arrows"`
+	Frequency           int      `json:"frequency"`
+	Decimals            int      `json:"decimals"`
+	SignificantDigits   int      `json:"significant_digits"`
+	Compact             bool     `json:"compact"`
+	SubscriptZeros      bool     `json:"subscript_zeros"`
+	ThousandsSeparators bool     `json:"thousands_separators"`
+	TrimZeros           bool     `json:"trim_zeros"`
+	Locale              string   `json:"locale"`
+	NicknameTemplate    string   `json:"nickname_template"`
+	ActivityTemplate    string   `json:"activity_template"`
 }
 
-// AddBoard adds a new board to the list of what to watch
-func (m *Manager) AddBoard(w http.ResponseWriter, r *http.Request) {
-	m.Lock()
-	defer m.Unlock()
-
-	logger.Debugf("Got an API request to add a ticker")
-
-	// read body
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		logger.Errorf("Error: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error reading body: %v", err)
-		return
-	}
-
-	// unmarshal into struct
-	var boardReq BoardRequest
-	if err := json.Unmarshal(body, &boardReq); err != nil {
-		logger.Errorf("Error unmarshalling: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error unmarshalling: %v", err)
-		return
-	}
-
-	// ensure token is set
-	if boardReq.Token == "" {
-		logger.Error("Discord token required")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: token required")
-		return
-	}
+func init() {
+	registerKind(&Kind{
+		Name:       kindBoard,
+		Path:       "/tickerboard",
+		Count:      boardCount,
+		NewRequest: func() Request { return &BoardRequest{} },
+		NewWatcher: newBoardWatcher,
+	})
+}
 
-	// ensure name is set
-	if boardReq.Name == "" {
-		logger.Error("Board Name required")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: name required")
-		return
-	}
+// newBoardWatcher creates a stock or crypto board from a validated request
+func newBoardWatcher(m *Manager, req Request) Watcher {
+	boardReq := req.(*BoardRequest)
 
-	// add stock or crypto ticker
+	var board *Board
 	if boardReq.Crypto {
-
-		// check if already existing
-		if _, ok := m.WatchingBoard[strings.ToUpper(boardReq.Name)]; ok {
-			logger.Error("Error: board already exists")
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
-
-		crypto := NewCryptoBoard(boardReq.Items, boardReq.Token, boardReq.Name, boardReq.Header, boardReq.Nickname, boardReq.Color, boardReq.Percentage, boardReq.Arrows, boardReq.Frequency, m.Cache, m.Context)
-		m.addBoard(crypto)
-
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(crypto)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-		}
-		return
-	}
-
-	// check if already existing
-	if _, ok := m.WatchingBoard[strings.ToUpper(boardReq.Name)]; ok {
-		logger.Error("Error: board already exists")
-		w.WriteHeader(http.StatusConflict)
-		return
+		board = NewCryptoBoard(boardReq.Items, boardReq.Token, boardReq.Name, boardReq.Header, boardReq.Nickname, boardReq.Color, boardReq.Percentage, boardReq.Arrows, boardReq.Frequency, boardReq.format())
+	} else {
+		board = NewStockBoard(boardReq.Items, boardReq.Token, boardReq.Name, boardReq.Header, boardReq.Nickname, boardReq.Color, boardReq.Percentage, boardReq.Arrows, boardReq.Frequency, boardReq.format())
 	}
+	board.request = boardReq
+	board.setTemplates(boardReq.NicknameTemplate, boardReq.ActivityTemplate)
 
-	stock := NewStockBoard(boardReq.Items, boardReq.Token, boardReq.Name, boardReq.Header, boardReq.Nickname, boardReq.Color, boardReq.Percentage, boardReq.Arrows, boardReq.Frequency)
-	m.addBoard(stock)
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(stock)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-	}
+	return board
 }
 
-func (m *Manager) addBoard(b *Board) {
-	boardCount.Inc()
-	m.WatchingBoard[b.Name] = b
-}
-
-// DeleteBoard removes a board
-func (m *Manager) DeleteBoard(w http.ResponseWriter, r *http.Request) {
-	m.Lock()
-	defer m.Unlock()
-
-	logger.Debugf("Got an API request to delete a board")
-
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	if _, ok := m.WatchingBoard[id]; !ok {
-		logger.Error("Error: no ticker found")
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprint(w, "Error: ticker not found")
-		return
+// validate fills in defaults and ensures the request can be used to start a board
+func (boardReq *BoardRequest) validate() error {
+	var v validator
+
+	v.require("discord_bot_token", boardReq.Token)
+	v.template("nickname_template", boardReq.NicknameTemplate)
+	v.template("activity_template", boardReq.ActivityTemplate)
+	v.require("name", boardReq.Name)
+	v.frequency(&boardReq.Frequency)
+	v.format(boardReq.format())
+
+	// ensure there is something to show
+	v.check(len(boardReq.Items) > 0, "items", "must have at least one item")
+	v.check(len(boardReq.Items) <= maxBoardItems, "items", "must have at most %d items", maxBoardItems)
+	for i, item := range boardReq.Items {
+		v.require(fmt.Sprintf("items[%d]", i), item)
 	}
-	// send shutdown sign
-	m.WatchingBoard[id].Shutdown()
-	boardCount.Dec()
 
-	// remove from cache
-	delete(m.WatchingBoard, id)
+	return v.err()
+}
 
-	logger.Infof("Deleted board %s", id)
-	w.WriteHeader(http.StatusNoContent)
+// id is the key the board is watched under
+func (boardReq BoardRequest) id() string {
+	return boardReq.Name
 }
 
-// GetBoards returns a list of what the manager is watching
-func (m *Manager) GetBoards(w http.ResponseWriter, r *http.Request) {
-	m.RLock()
-	defer m.RUnlock()
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(m.WatchingBoard); err != nil {
-		logger.Errorf("Error serving request: %v", err)
-		fmt.Fprintf(w, "Error: %v", err)
+// format is how the board shows numbers
+func (boardReq BoardRequest) format() utils.NumberFormat {
+	return utils.NumberFormat{
+		Decimals:    boardReq.Decimals,
+		Significant: boardReq.SignificantDigits,
+		Compact:     boardReq.Compact,
+		Subscript:   boardReq.SubscriptZeros,
+		Separators:  boardReq.ThousandsSeparators,
+		Trim:        boardReq.TrimZeros,
+		Locale:      boardReq.Locale,
 	}
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a fleet of bots, using the same fields as the api requests
+type Config struct {
+	Tickers []TickerRequest  `json:"tickers"`
+	Boards  []BoardRequest   `json:"boards"`
+	Gas     []GasRequest     `json:"gas"`
+	Tokens  []TokenRequest   `json:"tokens"`
+	Holders []HoldersRequest `json:"holders"`
+}
+
+// configEntry is a single validated bot from the config file
+type configEntry struct {
+	kind    string
+	id      string
+	request Request
+}
+
+// LoadConfig reads a yaml or json config file
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	// yaml is converted to json so the request structs only need json tags
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return config, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		data, err = json.Marshal(raw)
+		if err != nil {
+			return config, fmt.Errorf("converting %s: %w", path, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// entries validates every bot in the config, skipping (and logging) the bad ones
+func (c Config) entries() map[string]configEntry {
+	entries := make(map[string]configEntry)
+
+	add := func(kind string, req Request) {
+		if err := req.validate(); err != nil {
+			logger.Errorf("Skipping %s %s in config: %s", kind, req.id(), err)
+			return
+		}
+
+		key := storeKey(kind, req.id())
+		if _, ok := entries[key]; ok {
+			logger.Errorf("Skipping duplicate %s %s in config", kind, req.id())
+			return
+		}
+		entries[key] = configEntry{kind, req.id(), req}
+	}
+
+	for i := range c.Tickers {
+		add(kindTicker, &c.Tickers[i])
+	}
+	for i := range c.Boards {
+		add(kindBoard, &c.Boards[i])
+	}
+	for i := range c.Gas {
+		add(kindGas, &c.Gas[i])
+	}
+	for i := range c.Tokens {
+		add(kindToken, &c.Tokens[i])
+	}
+	for i := range c.Holders {
+		add(kindHolders, &c.Holders[i])
+	}
+
+	return entries
+}
+
+// ApplyConfig makes the running bots match the config: new bots are started, bots removed
+// from the config are shut down and bots whose settings changed are restarted.
+// Bots added through the api are left alone.
+func (m *Manager) ApplyConfig(config Config) {
+	m.Lock()
+	defer m.Unlock()
+
+	desired := config.entries()
+
+	// shut down what is no longer in the config
+	for key, e := range m.configured {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+
+		if _, ok := m.watchers[key]; ok {
+			m.stop(kinds[e.kind], e.id)
+			logger.Infof("Config removed %s %s", e.kind, e.id)
+		}
+		delete(m.configured, key)
+	}
+
+	// start new bots and restart changed ones
+	for key, e := range desired {
+		running, ok := m.watchers[key]
+		if ok && reflect.DeepEqual(running.Config(), e.request) {
+			// a bot restored from the store is adopted by the config, so it is not restored twice
+			if _, adopted := m.configured[key]; !adopted {
+				m.forget(e.kind, e.id)
+			}
+			m.configured[key] = e
+			continue
+		}
+
+		if ok {
+			m.stop(kinds[e.kind], e.id)
+			logger.Infof("Config changed %s %s", e.kind, e.id)
+		} else {
+			logger.Infof("Config added %s %s", e.kind, e.id)
+		}
+
+		m.start(kinds[e.kind], e.request)
+		m.configured[key] = e
+
+		// the config file is the source of truth for this bot now
+		m.forget(e.kind, e.id)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/rssnyder/discord-stock-ticker/utils"
+)
+
+const (
+	defaultFrequency = 60
+	maxDecimals      = 11
+	maxSignificant   = 15
+	maxBoardItems    = 50
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Za-z]{3}$`)
+	// coingecko also prices coins in a few longer units, like sats and bits
+	coinCurrencyPattern = regexp.MustCompile(`^[A-Za-z]{3,4}$`)
+	networks            = []string{"ethereum", "binance-smart-chain", "polygon"}
+	tokenSources        = []string{"1inch", "pancakeswap"}
+)
+
+// APIError is the json document returned for every failed api request
+type APIError struct {
+	Status  int          `json:"status"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError holds every problem found in a request
+type ValidationError []FieldError
+
+func (v ValidationError) Error() string {
+	problems := make([]string, len(v))
+	for i, f := range v {
+		problems[i] = fmt.Sprintf("%s %s", f.Field, f.Message)
+	}
+	return strings.Join(problems, ", ")
+}
+
+// validator collects field problems while checking a request
+type validator struct {
+	errs ValidationError
+}
+
+// check records a problem with a field when ok is false
+func (v *validator) check(ok bool, field string, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{field, fmt.Sprintf(format, args...)})
+	}
+}
+
+// require records a problem if a string field is empty
+func (v *validator) require(field string, value string) {
+	v.check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// frequency defaults an unset frequency and rejects negative ones
+func (v *validator) frequency(frequency *int) {
+	if *frequency == 0 {
+		*frequency = defaultFrequency
+	}
+	v.check(*frequency > 0, "frequency", "must be greater than 0")
+}
+
+// format ensures decimals and significant digits are between 0 (automatic) and the max we can format, and only one is set
+func (v *validator) format(f utils.NumberFormat) {
+	v.check(f.Decimals >= 0 && f.Decimals <= maxDecimals, "decimals", "must be between 0 and %d", maxDecimals)
+	v.check(f.Significant >= 0 && f.Significant <= maxSignificant, "significant_digits", "must be between 0 and %d", maxSignificant)
+	v.check(f.Decimals == 0 || f.Significant == 0, "significant_digits", "cannot be used with decimals")
+	if f.Locale != "" {
+		v.oneOf("locale", f.Locale, utils.Locales())
+	}
+}
+
+// oneOf ensures a field is one of the known values
+func (v *validator) oneOf(field string, value string, options []string) {
+	for _, o := range options {
+		if value == o {
+			return
+		}
+	}
+	v.check(false, field, "must be one of: %s", strings.Join(options, ", "))
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// writeError sends an error document
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeAPIError(w, APIError{
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// writeValidationError sends the field problems of a request that failed validation
+func writeValidationError(w http.ResponseWriter, err error) {
+	var fields ValidationError
+	if !errors.As(err, &fields) {
+		writeError(w, http.StatusUnprocessableEntity, "%s", err)
+		return
+	}
+
+	writeAPIError(w, APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Message: "Invalid request",
+		Fields:  fields,
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr APIError) {
+	logger.Errorf("API error %d: %s %v", apiErr.Status, apiErr.Message, apiErr.Fields)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(apiErr.Status)
+	if err := json.NewEncoder(w).Encode(apiErr); err != nil {
+		logger.Errorf("Unable to encode error: %s", err)
+	}
+}
+
+// decodeRequest reads a json request body into req, sending a 400 if it cannot
+func decodeRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unable to read body: %s", err)
+		return false
+	}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed json: %s", err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/rssnyder/discord-stock-ticker/utils"
+)
+
+const (
+	// maxNickname and maxActivity are the longest nickname and activity discord accepts, in UTF-16 code units
+	maxNickname = 32
+	maxActivity = 128
+	// fitDigits is how many significant digits of a price fitting keeps before it moves on to other steps
+	fitDigits = 2
+	// ellipsis marks text that was truncated to fit
+	ellipsis = "…"
+)
+
+// displayNumbers are the raw numbers behind a display, so fitting can format them again
+type displayNumbers struct {
+	format utils.NumberFormat
+	price  float64
+	change float64
+}
+
+// withNumbers lets fitting write price and change again with fewer decimals or compacted when the display is too long
+func (d Display) withNumbers(format utils.NumberFormat, price float64, change float64) Display {
+	d.numbers = &displayNumbers{
+		format: format,
+		price:  price,
+		change: change,
+	}
+	return d
+}
+
+// reformat writes price and change with format
+func (d *Display) reformat(format utils.NumberFormat) {
+	d.Price = format.Format(d.numbers.price)
+	d.FullPrice = d.money(format, d.Price)
+	if d.Change != "" {
+		d.Change = format.Format(d.numbers.change)
+		d.FullChange = d.money(format, d.Change)
+	}
+}
+
+// fit renders a display no longer than max. When it is too long it drops decimals, then compacts numbers,
+// then shortens the name, and only truncates the text when nothing else was enough.
+func fit(what string, max int, render func(Display) string, d Display) string {
+	text := render(d)
+	if discordLength(text) <= max {
+		return text
+	}
+	original := text
+
+	fitted := func(step string, text string) string {
+		logger.Debugf("Shortened %s %q to %q by %s to fit the %d characters discord allows", what, original, text, step, max)
+		return text
+	}
+
+	if d.numbers != nil {
+		for _, format := range fewerDigits(d.numbers.format, d.numbers.price) {
+			d.reformat(format)
+			if text = render(d); discordLength(text) <= max {
+				return fitted("dropping decimals", text)
+			}
+		}
+
+		if math.Abs(d.numbers.price) >= 1000 {
+			for decimals := 2; decimals >= 0; decimals-- {
+				format := d.numbers.format.Fixed(decimals)
+				format.Compact = true
+				d.reformat(format)
+				if text = render(d); discordLength(text) <= max {
+					return fitted("compacting numbers", text)
+				}
+			}
+		}
+	}
+
+	// boards show a header and symbol rather than the name, shorten whichever the template shows
+	for _, name := range []*string{&d.Name, &d.Header, &d.Symbol} {
+		var ok bool
+		if text, ok = shorten(name, max, render, &d, text); ok {
+			return fitted("shortening the name", text)
+		}
+	}
+
+	return fitted("truncating", truncate(text, max))
+}
+
+// shorten drops the last rune of field until the display fits, returning the text and if it fits. Trailing
+// spaces, like the one separating a board header, are kept. It gives up on a field the template does not show,
+// when shortening it leaves the text as it was.
+func shorten(field *string, max int, render func(Display) string, d *Display, text string) (string, bool) {
+	body := strings.TrimRightFunc(*field, unicode.IsSpace)
+	tail := (*field)[len(body):]
+
+	runes := []rune(body)
+	for len(runes) > 1 {
+		runes = runes[:len(runes)-1]
+		shorter := strings.TrimSpace(string(runes)) + tail
+		if shorter == *field {
+			continue
+		}
+		*field = shorter
+		shortened := render(*d)
+		if shortened == text {
+			return text, false
+		}
+		if text = shortened; discordLength(text) <= max {
+			return text, true
+		}
+	}
+
+	return text, false
+}
+
+// fitText truncates text that cannot be formatted again, like a custom activity, to what discord allows
+func fitText(what string, max int, text string) string {
+	if discordLength(text) <= max {
+		return text
+	}
+
+	fitted := truncate(text, max)
+	logger.Debugf("Shortened %s %q to %q by truncating to fit the %d characters discord allows", what, text, fitted, max)
+	return fitted
+}
+
+// fewerDigits lists the formats fitting tries, each one digit shorter than the last,
+// stopping once the price would be left with fewer than fitDigits significant digits
+func fewerDigits(format utils.NumberFormat, price float64) []utils.NumberFormat {
+	var formats []utils.NumberFormat
+
+	if format.Significant > 0 {
+		for format.Significant > fitDigits {
+			format.Significant--
+			formats = append(formats, format)
+		}
+		return formats
+	}
+
+	// the decimals it takes to show fitDigits significant digits of the price
+	least := 0
+	if price != 0 {
+		least = fitDigits - int(math.Floor(math.Log10(math.Abs(price)))) - 1
+	}
+	for format.Decimals > least && format.Decimals > 0 {
+		format.Decimals--
+		formats = append(formats, format)
+	}
+
+	return formats
+}
+
+// discordLength is how long discord considers text to be
+func discordLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// truncate cuts text down to max, ending it with an ellipsis, text that already fits is left alone
+func truncate(text string, max int) string {
+	if discordLength(text) <= max {
+		return text
+	}
+	limit := max - discordLength(ellipsis)
+
+	length := 0
+	for i, r := range text {
+		length += len(utf16.Encode([]rune{r}))
+		if length > limit {
+			return text[:i] + ellipsis
+		}
+	}
+
+	return text
+}
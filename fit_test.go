@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rssnyder/discord-stock-ticker/utils"
+)
+
+func TestFit(t *testing.T) {
+	nickname := mustTemplate("{{.Name}} {{.FullPrice}}")
+
+	tests := []struct {
+		name    string
+		max     int
+		display Display
+		want    string
+	}{
+		{
+			name:    "short enough",
+			max:     32,
+			display: Display{Name: "BTC"}.withNumbers(utils.NumberFormat{Decimals: 2}, 12345.678, 0),
+			want:    "BTC $12345.68",
+		},
+		{
+			name:    "drops decimals",
+			max:     10,
+			display: Display{Name: "ADA"}.withNumbers(utils.NumberFormat{Decimals: 6}, 1.23456789, 0),
+			want:    "ADA $1.235",
+		},
+		{
+			name:    "keeps two significant digits, then shortens the name",
+			max:     7,
+			display: Display{Name: "ADA"}.withNumbers(utils.NumberFormat{Decimals: 6}, 1.23456789, 0),
+			want:    "AD $1.2",
+		},
+		{
+			name:    "compacts large numbers",
+			max:     10,
+			display: Display{Name: "BTC"}.withNumbers(utils.NumberFormat{Decimals: 2}, 1234567.89, 0),
+			want:    "BTC $1.23M",
+		},
+		{
+			name:    "compacts with fewer decimals",
+			max:     8,
+			display: Display{Name: "BTC"}.withNumbers(utils.NumberFormat{Decimals: 2}, 1234567.89, 0),
+			want:    "BTC $1M",
+		},
+		{
+			name:    "shortens the name",
+			max:     12,
+			display: Display{Name: "SUPER LONG NAME", Price: "1.00", FullPrice: "$1.00"},
+			want:    "SUPER $1.00",
+		},
+		{
+			name:    "truncates when nothing else fits",
+			max:     4,
+			display: Display{Name: "X", Price: "123456", FullPrice: "$123456"},
+			want:    "X $…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.display
+			d.CurrencySymbol = "$"
+			if d.numbers != nil {
+				d.reformat(d.numbers.format)
+			}
+
+			got := fit("nickname", tt.max, func(d Display) string {
+				return render(nil, nickname, d)
+			}, d)
+			if got != tt.want {
+				t.Errorf("fit() = %q, want %q", got, tt.want)
+			}
+			if discordLength(got) > tt.max {
+				t.Errorf("fit() = %q is %d long, over %d", got, discordLength(got), tt.max)
+			}
+		})
+	}
+}
+
+func TestFitBoard(t *testing.T) {
+	// boards show the header and symbol, shortening the name would change nothing
+	d := Display{Name: "Bitcoin", Header: "CRYPTO ", Symbol: "BITCOIN", Decorator: "⬈", Price: "1.00", FullPrice: "$1.00"}
+
+	got := fit("nickname", 12, func(d Display) string {
+		return render(nil, boardNickname, d)
+	}, d)
+	if want := "C BI ⬈ $1.00"; got != want {
+		t.Errorf("fit() = %q, want %q", got, want)
+	}
+}
+
+func TestFitText(t *testing.T) {
+	short := "Hello"
+	if got := fitText("activity", maxActivity, short); got != short {
+		t.Errorf("fitText(%q) = %q, want it unchanged", short, got)
+	}
+
+	long := strings.Repeat("a", maxActivity+10)
+	got := fitText("activity", maxActivity, long)
+	if discordLength(got) != maxActivity || !strings.HasSuffix(got, ellipsis) {
+		t.Errorf("fitText() of %d characters = %q, want %d ending in %q", len(long), got, maxActivity, ellipsis)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"abc", 3, "abc"},
+		{"abcdef", 4, "abc…"},
+		{"héllo wörld", 6, "héllo…"},
+		{"a😀b", 4, "a😀b"},
+		{"a😀bc", 4, "a😀…"},
+		{"a😀bc", 3, "a…"},
+		{"", 3, ""},
+	}
+
+	for _, tt := range tests {
+		if got := truncate(tt.text, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestDiscordLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"⬈ €", 3},
+		{"😀", 2},
+		{"⚡ 12 🤔 10", 10},
+	}
+
+	for _, tt := range tests {
+		if got := discordLength(tt.text); got != tt.want {
+			t.Errorf("discordLength(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
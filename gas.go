@@ -1,63 +1,71 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
+var (
+	// default display formats of gas watchers
+	gasNickname = mustTemplate("⚡ {{.Instant}} 🤔 {{.Fast}} 🐌 {{.Standard}}")
+	gasActivity = mustTemplate("Fast, Avg, Slow")
+)
+
 // Gas represents the gas data
 type Gas struct {
 	Network   string        `json:"network"`
 	Nickname  bool          `json:"set_nickname"`
 	Frequency time.Duration `json:"frequency"`
-	token     string        `json:"-"`
-	close     chan int      `json:"-"`
+	watcher
 }
 
+// NewGas saves information about the network to watch
 func NewGas(network string, token string, nickname bool, frequency int) *Gas {
 	g := &Gas{
 		Network:   network,
 		Nickname:  nickname,
 		Frequency: time.Duration(frequency) * time.Second,
-		token:     token,
-		close:     make(chan int, 1),
+		watcher:   newWatcher(token),
 	}
 
-	// spin off go routine to watch the prices
-	go g.watchGasPrice()
 	return g
 }
 
-// Shutdown sends a signal to shut off the goroutine
-func (g *Gas) Shutdown() {
-	g.close <- 1
+// Start spins off a go routine to watch the prices
+func (g *Gas) Start(ctx context.Context) {
+	g.begin(ctx)
+	go g.watchGasPrice()
 }
 
-// watchGasPrice gets gas prices and rotates through levels
-func (g *Gas) watchGasPrice() {
+// Update changes the settings of the running gas watcher without reconnecting to discord
+func (g *Gas) Update(req Request) error {
+	gasReq := req.(*GasRequest)
+	old := g.request.(*GasRequest)
 
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + g.token)
-	if err != nil {
-		fmt.Println("Error creating Discord session: ", err)
-		return
+	if old.Token != gasReq.Token {
+		return errRestartRequired
 	}
 
-	// show as online
-	err = dg.Open()
-	if err != nil {
-		fmt.Println("error opening discord connection,", err)
-		return
-	}
+	return g.sendUpdate(gasReq)
+}
+
+// apply copies the settings that can change on the fly from a request, it is only called from the watching goroutine
+func (g *Gas) apply(req *GasRequest) {
+	g.Nickname = req.Nickname
+	g.Frequency = time.Duration(req.Frequency) * time.Second
+	g.setTemplates(req.NicknameTemplate, req.ActivityTemplate)
+}
+
+// watchGasPrice gets gas prices and rotates through levels
+func (g *Gas) watchGasPrice() {
+	defer g.exit()
 
-	// Get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
+	dg, _, err := g.connect()
 	if err != nil {
-		fmt.Println("Error getting guilds: ", err)
-		g.Nickname = false
+		logger.Errorf("Connecting to discord for %s: %s", g.Network, err)
+		return
 	}
 
 	ticker := time.NewTicker(g.Frequency)
@@ -67,47 +75,59 @@ func (g *Gas) watchGasPrice() {
 	for {
 
 		select {
-		case <-g.close:
+		case <-g.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", g.Network)
 			return
+		case u := <-g.update:
+			g.apply(u.request.(*GasRequest))
+			ticker.Reset(g.Frequency)
+
+			logger.Infof("Updated settings for %s", g.Network)
+			close(u.applied)
 		case <-ticker.C:
 			// get gas prices
-			gasPrices, err := utils.GetGasPrices(g.Network)
+			gasPrices, err := utils.GetGasPrices(g.ctx, g.Network)
 			if err != nil {
-				fmt.Printf("Error getting rates: %s\n", err)
-				time.Sleep(g.Frequency)
+				logger.Errorf("Unable to fetch gas prices for %s: %s", g.Network, err)
 				continue
 			}
 
-			nickname = fmt.Sprintf("⚡ %d 🤔 %d 🐌 %d", gasPrices.Instant, gasPrices.Fast, gasPrices.Standard)
+			display := Display{
+				Name:     g.Network,
+				Instant:  gasPrices.Instant,
+				Fast:     gasPrices.Fast,
+				Standard: gasPrices.Standard,
+			}
 
 			// change nickname
 			if g.Nickname {
+				nickname = g.nickname(gasNickname, display)
 
-				for _, g := range guilds {
+				for _, g := range g.guildList() {
 
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
-						fmt.Printf("Error updating nickname: %s\n", err)
+						logger.Errorf("Updating nickname: %s", err)
 						continue
 					} else {
-						fmt.Printf("Set nickname in %s: %s\n", g.Name, nickname)
+						logger.Infof("Set nickname in %s: %s", g.Name, nickname)
 					}
 				}
 
-				err = dg.UpdateGameStatus(0, "Fast, Avg, Slow")
+				err = dg.UpdateGameStatus(0, g.activity(gasActivity, display))
 				if err != nil {
-					fmt.Printf("Unable to set activity: %s\n", err)
+					logger.Errorf("Unable to set activity: %s", err)
 				} else {
-					fmt.Println("Set activity")
+					logger.Info("Set activity")
 				}
 			} else {
+				nickname = g.activity(gasNickname, display)
 
 				err = dg.UpdateGameStatus(0, nickname)
 				if err != nil {
-					fmt.Printf("Unable to set activity: %s\n", err)
+					logger.Errorf("Unable to set activity: %s", err)
 				} else {
-					fmt.Printf("Set activity: %s\n", nickname)
+					logger.Infof("Set activity: %s", nickname)
 				}
 			}
 		}
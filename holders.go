@@ -1,13 +1,15 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
+// holdersNickname is the default display format of holders watchers
+var holdersNickname = mustTemplate("{{.Holders}}")
+
 // Holders represents the json for holders
 type Holders struct {
 	Network   string        `json:"network"`
@@ -15,11 +17,10 @@ type Holders struct {
 	Activity  string        `json:"activity"`
 	Nickname  bool          `json:"set_nickname"`
 	Frequency time.Duration `json:"frequency"`
-	token     string        `json:"-"`
-	close     chan int      `json:"-"`
+	watcher
 }
 
-// NewHolders saves information about the stock and starts up a watcher on it
+// NewHolders saves information about the contract to watch
 func NewHolders(network string, address string, activity string, token string, nickname bool, frequency int) *Holders {
 	h := &Holders{
 		Network:   network,
@@ -27,85 +28,121 @@ func NewHolders(network string, address string, activity string, token string, n
 		Activity:  activity,
 		Nickname:  nickname,
 		Frequency: time.Duration(frequency) * time.Second,
-		token:     token,
-		close:     make(chan int, 1),
+		watcher:   newWatcher(token),
 	}
 
-	// spin off go routine to watch the price
-	go h.watchHolders()
 	return h
 }
 
-// Shutdown sends a signal to shut off the goroutine
-func (h *Holders) Shutdown() {
-	h.close <- 1
+// Start spins off a go routine to watch the holders
+func (h *Holders) Start(ctx context.Context) {
+	h.begin(ctx)
+	go h.watchHolders()
 }
 
-func (h *Holders) watchHolders() {
+// Update changes the settings of the running holders watcher without reconnecting to discord
+func (h *Holders) Update(req Request) error {
+	holdersReq := req.(*HoldersRequest)
+	old := h.request.(*HoldersRequest)
 
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + h.token)
-	if err != nil {
-		fmt.Println("Error creating Discord session: ", err)
-		return
+	if old.Token != holdersReq.Token {
+		return errRestartRequired
 	}
 
-	// show as online
-	err = dg.Open()
+	return h.sendUpdate(holdersReq)
+}
+
+// apply copies the settings that can change on the fly from a request, it is only called from the watching goroutine
+func (h *Holders) apply(req *HoldersRequest) {
+	h.Activity = req.Activity
+	h.Nickname = req.Nickname
+	h.Frequency = time.Duration(req.Frequency) * time.Second
+	h.setTemplates(req.NicknameTemplate, req.ActivityTemplate)
+}
+
+func (h *Holders) watchHolders() {
+	defer h.exit()
+
+	dg, _, err := h.connect()
 	if err != nil {
-		fmt.Println("error opening discord connection,", err)
+		logger.Errorf("Connecting to discord for %s: %s", h.Network, err)
 		return
 	}
 
 	// set activity as desc
 	if h.Nickname {
-		err = dg.UpdateGameStatus(0, h.Activity)
+		err = dg.UpdateGameStatus(0, fitText("activity", maxActivity, h.Activity))
 		if err != nil {
-			fmt.Printf("Unable to set activity: %s\n", err)
+			logger.Errorf("Unable to set activity: %s", err)
 		} else {
-			fmt.Println("Set activity")
+			logger.Info("Set activity")
 		}
 	}
 
-	// get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
-	if err != nil {
-		fmt.Println("Error getting guilds: ", err)
-		h.Nickname = false
-	}
-
 	ticker := time.NewTicker(h.Frequency)
 	var nickname string
 
 	for {
 
 		select {
-		case <-h.close:
+		case <-h.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", h.Activity)
 			return
+		case u := <-h.update:
+			h.apply(u.request.(*HoldersRequest))
+			ticker.Reset(h.Frequency)
+
+			// set activity as desc
+			if h.Nickname {
+				err = dg.UpdateGameStatus(0, fitText("activity", maxActivity, h.Activity))
+				if err != nil {
+					logger.Errorf("Unable to set activity: %s", err)
+				}
+			}
+
+			logger.Infof("Updated settings for %s", h.Activity)
+			close(u.applied)
 		case <-ticker.C:
 
-			nickname = utils.GetHolders(h.Network, h.Address)
+			holders, err := utils.GetHolders(h.ctx, h.Network, h.Address)
+			if err != nil {
+				logger.Errorf("Unable to fetch holders for %s: %s", h.Address, err)
+				continue
+			}
+			display := Display{
+				Name:    h.Activity,
+				Holders: holders,
+			}
 
 			if h.Nickname {
+				nickname = h.nickname(holdersNickname, display)
 
-				for _, g := range guilds {
+				for _, g := range h.guildList() {
 
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
-						fmt.Printf("Error updating nickname: %s\n", err)
+						logger.Errorf("Updating nickname: %s", err)
 						continue
 					} else {
-						fmt.Printf("Set nickname in %s: %s\n", g.Name, nickname)
+						logger.Infof("Set nickname in %s: %s", g.Name, nickname)
+					}
+				}
+
+				// the activity stays the description unless it is templated
+				if h.activityTemplate != nil {
+					err = dg.UpdateGameStatus(0, h.activity(holdersNickname, display))
+					if err != nil {
+						logger.Errorf("Unable to set activity: %s", err)
 					}
 				}
 			} else {
+				nickname = h.activity(holdersNickname, display)
 
 				err = dg.UpdateGameStatus(0, nickname)
 				if err != nil {
-					fmt.Printf("Unable to set activity: %s\n", err)
+					logger.Errorf("Unable to set activity: %s", err)
 				} else {
-					fmt.Printf("Set activity: %s\n", nickname)
+					logger.Infof("Set activity: %s", nickname)
 				}
 			}
 		}
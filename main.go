@@ -4,21 +4,44 @@ import (
 	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
 var (
-	logger       = log.New()
-	address      *string
-	redisAddress *string
-	cache        *bool
-	rdb          *redis.Client
-	ctx          context.Context
-	tickerCount  = prometheus.NewGauge(
+	logger         = log.New()
+	logLevel       *int
+	address        *string
+	redisAddress   *string
+	cache          *bool
+	cacheTTL       *int
+	cacheProviders *string
+	cacheBackend   *string
+	cacheSize      *int
+	store          *string
+	storePath      *string
+	configPath     *string
+	adminKeys      *string
+	readKeys       *string
+	keysFile       *string
+	freshness      *int
+	httpTimeout    *int
+	httpRetries    *int
+	rateLimits     *string
+	batchInterval  *int
+	fxInterval     *int
+	rdb            *redis.Client
+	tickerCount    = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "ticker_count",
 			Help: "Number of tickers.",
@@ -52,10 +75,32 @@ var (
 
 func init() {
 	// initialize logging
-	logLevel := flag.Int("logLevel", 0, "defines the log level. 0=production builds. 1=dev builds.")
+	logLevel = flag.Int("logLevel", 0, "defines the log level. 0=production builds. 1=dev builds.")
 	address = flag.String("address", "localhost:8080", "address:port to bind http server to.")
 	redisAddress = flag.String("redisAddress", "localhost:6379", "address:port for redis server.")
-	cache = flag.Bool("cache", false, "enable cache for coingecko")
+	cache = flag.Bool("cache", false, "enable cache for price data")
+	cacheTTL = flag.Int("cacheTTL", 60, "seconds cached prices are used for.")
+	cacheBackend = flag.String("cacheBackend", "memory", "where to cache price data: memory or redis.")
+	cacheSize = flag.Int("cacheSize", 1000, "most prices the memory cache holds before evicting the least recently used.")
+	cacheProviders = flag.String("cacheProviders", "coingecko", "comma separated price providers that use the cache: coingecko, yahoo, 1inch.")
+	store = flag.String("store", "file", "where to persist running bots: file, redis, or none.")
+	storePath = flag.String("storePath", "discord-stock-ticker.json", "path of the state file for the file store.")
+	configPath = flag.String("config", "", "yaml or json file describing bots to run, reloaded on SIGHUP.")
+	adminKeys = flag.String("adminKeys", "", "comma separated api keys allowed to add, change, and remove bots.")
+	readKeys = flag.String("readKeys", "", "comma separated api keys allowed to list bots.")
+	keysFile = flag.String("keysFile", "", "file of api keys, one \"<admin|read> <key>\" per line.")
+	freshness = flag.Int("freshness", 30, "seconds a price is shared between bots watching the same symbol.")
+	httpTimeout = flag.Int("httpTimeout", 10, "seconds to wait for a price source to answer.")
+	httpRetries = flag.Int("httpRetries", 2, "times to retry a failed call to a price source.")
+	rateLimits = flag.String("rateLimits", "", "comma separated calls per minute allowed for each price source, e.g. coingecko=50,yahoo=120. 0 disables a limit.")
+	batchInterval = flag.Int("batchInterval", 30, "seconds between refreshing every watched coin and stock at once. 0 fetches each symbol on its own.")
+	fxInterval = flag.Int("fxInterval", 300, "seconds between refreshing the exchange rates of stock tickers.")
+}
+
+func main() {
+	var wg sync.WaitGroup
+
+	// Flags are parsed here rather than in init so the package can be tested
 	flag.Parse()
 	logger.Out = os.Stdout
 	switch *logLevel {
@@ -64,24 +109,136 @@ func init() {
 	default:
 		logger.SetLevel(log.DebugLevel)
 	}
-}
+	utils.Logger = logger
 
-func main() {
-	var wg sync.WaitGroup
+	// Calls to price sources give up after the timeout and retry a few times
+	utils.DefaultClient.HTTP.Timeout = time.Duration(*httpTimeout) * time.Second
+	utils.DefaultClient.Retries = *httpRetries
 
-	// Redis is used a an optional cache for coingecko data
+	// Override how often each price source can be called
+	for _, limit := range strings.Split(*rateLimits, ",") {
+		if strings.TrimSpace(limit) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(limit, "=", 2)
+		perMinute, err := strconv.Atoi(strings.TrimSpace(parts[len(parts)-1]))
+		if len(parts) != 2 || err != nil {
+			logger.Fatalf("Bad rate limit %q, expected <source>=<calls per minute>", limit)
+		}
+		if err := utils.SetRateLimit(strings.TrimSpace(parts[0]), perMinute); err != nil {
+			logger.Fatalf("Bad rate limit %q: %s", limit, err)
+		}
+	}
+
+	// Bots watching the same symbol share prices fetched within this window
+	utils.DefaultScheduler.SetFreshness(time.Duration(*freshness) * time.Second)
+
+	// Price data can optionally be cached in process or in redis
 	if *cache {
-		rdb = redis.NewClient(&redis.Options{
-			Addr:     *redisAddress,
-			Password: "",
-			DB:       0,
-		})
-		ctx = context.Background()
+		var priceCache utils.Cache
+		switch *cacheBackend {
+		case "memory":
+			priceCache = utils.NewMemoryCache(*cacheSize)
+		case "redis":
+			rdb = redis.NewClient(&redis.Options{
+				Addr:     *redisAddress,
+				Password: "",
+				DB:       0,
+			})
+			priceCache = utils.NewRedisCache(rdb, context.Background())
+		default:
+			logger.Fatalf("Unknown cache backend %s, use memory or redis", *cacheBackend)
+		}
+
+		err := utils.EnableCache(priceCache, time.Duration(*cacheTTL)*time.Second, strings.Split(*cacheProviders, ",")...)
+		if err != nil {
+			logger.Fatalf("Setting up cache: %s", err)
+		}
+	}
+
+	// Watched coins and stocks are refreshed together instead of once per bot
+	if *batchInterval > 0 {
+		utils.StartBatching(time.Duration(*batchInterval) * time.Second)
+	}
+
+	// Exchange rates are shared by every stock ticker and refreshed in the background
+	utils.StartFXRates(time.Duration(*fxInterval) * time.Second)
+
+	// Pick where running bots are persisted
+	var state Store
+	switch *store {
+	case "file":
+		fileStore, err := NewFileStore(*storePath)
+		if err != nil {
+			logger.Fatalf("Opening state file: %s", err)
+		}
+		state = fileStore
+	case "redis":
+		storeClient := rdb
+		if storeClient == nil {
+			storeClient = redis.NewClient(&redis.Options{
+				Addr:     *redisAddress,
+				Password: "",
+				DB:       0,
+			})
+		}
+		state = NewRedisStore(storeClient, context.Background())
+	case "none":
+		logger.Warn("Running without a store, bots will not survive a restart")
+	default:
+		logger.Fatalf("Unknown store: %s", *store)
+	}
+
+	// Collect the keys for the api
+	keys := make(APIKeys)
+	keys.Add(*readKeys, scopeRead)
+	keys.Add(*adminKeys, scopeAdmin)
+	if *keysFile != "" {
+		if err := keys.LoadFile(*keysFile); err != nil {
+			logger.Fatalf("Loading api keys: %s", err)
+		}
+	}
+	if len(keys) == 0 {
+		logger.Warn("No api keys set, anyone who can reach the api can manage bots")
 	}
 
 	// Create the bot manager
 	wg.Add(1)
-	NewManager(*address, tickerCount, rdb, ctx)
+	m := NewManager(*address, state, keys)
+
+	// Start the bots in the config file and reload it on SIGHUP
+	if *configPath != "" {
+		config, err := LoadConfig(*configPath)
+		if err != nil {
+			logger.Fatalf("Loading config: %s", err)
+		}
+		m.ApplyConfig(config)
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				logger.Infof("Reloading config %s", *configPath)
+				config, err := LoadConfig(*configPath)
+				if err != nil {
+					logger.Errorf("Reloading config: %s", err)
+					continue
+				}
+				m.ApplyConfig(config)
+			}
+		}()
+	}
+
+	// Disconnect every bot from discord before exiting
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-stop
+		logger.Infof("Got %s, shutting down", sig)
+		m.Shutdown()
+		wg.Done()
+	}()
 
 	// wait forever
 	wg.Wait()
@@ -7,70 +7,58 @@ import (
 	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
 // Manager holds a list of the crypto and stocks we are watching
 type Manager struct {
-	WatchingTicker  map[string]*Ticker
-	WatchingBoard   map[string]*Board
-	WatchingGas     map[string]*Gas
-	WatchingToken   map[string]*Token
-	WatchingHolders map[string]*Holders
-	Cache           *redis.Client
-	Context         context.Context
+	Store      Store
+	APIKeys    APIKeys
+	watchers   map[string]Watcher
+	sessions   *SessionPool
+	configured map[string]configEntry
+	ctx        context.Context
+	cancel     context.CancelFunc
 	sync.RWMutex
 }
 
 // NewManager stores all the information about the current stocks being watched and
-func NewManager(address string, count prometheus.Gauge, cache *redis.Client, context context.Context) *Manager {
+func NewManager(address string, store Store, keys APIKeys) *Manager {
 	m := &Manager{
-		WatchingTicker:  make(map[string]*Ticker),
-		WatchingBoard:   make(map[string]*Board),
-		WatchingGas:     make(map[string]*Gas),
-		WatchingToken:   make(map[string]*Token),
-		WatchingHolders: make(map[string]*Holders),
-		Cache:           cache,
-		Context:         context,
+		Store:      store,
+		APIKeys:    keys,
+		watchers:   make(map[string]Watcher),
+		sessions:   NewSessionPool(),
+		configured: make(map[string]configEntry),
 	}
 
-	// Create a router to accept requests
-	r := mux.NewRouter()
-
-	// Ticker
-	r.HandleFunc("/ticker", m.AddTicker).Methods("POST")
-	r.HandleFunc("/ticker/{id}", m.DeleteTicker).Methods("DELETE")
-	r.HandleFunc("/ticker", m.GetTickers).Methods("GET")
-
-	// Board
-	r.HandleFunc("/tickerboard", m.AddBoard).Methods("POST")
-	r.HandleFunc("/tickerboard/{id}", m.DeleteBoard).Methods("DELETE")
-	r.HandleFunc("/tickerboard", m.GetBoards).Methods("GET")
+	// Every bot runs under this context so they can all be stopped together
+	m.ctx, m.cancel = context.WithCancel(context.Background())
 
-	// Gas
-	r.HandleFunc("/gas", m.AddGas).Methods("POST")
-	r.HandleFunc("/gas/{id}", m.DeleteGas).Methods("DELETE")
-	r.HandleFunc("/gas", m.GetGas).Methods("GET")
+	// Bring back the bots we were running before a restart
+	m.restore()
 
-	// Token
-	r.HandleFunc("/token", m.AddToken).Methods("POST")
-	r.HandleFunc("/token/{id}", m.DeleteToken).Methods("DELETE")
-	r.HandleFunc("/token", m.GetToken).Methods("GET")
+	// Create a router to accept requests
+	r := mux.NewRouter()
+	r.Use(m.authenticate)
 
-	// Holders
-	r.HandleFunc("/holders", m.AddHolders).Methods("POST")
-	r.HandleFunc("/holders/{id}", m.DeleteHolders).Methods("DELETE")
-	r.HandleFunc("/holders", m.GetHolders).Methods("GET")
+	// Every kind of bot gets the same api and a gauge
+	for _, k := range sortedKinds() {
+		m.route(r, k)
+		prometheus.MustRegister(k.Count)
+	}
 
 	// Metrics
-	prometheus.MustRegister(tickerCount)
-	prometheus.MustRegister(boardCount)
-	prometheus.MustRegister(gasCount)
-	prometheus.MustRegister(tokenCount)
-	prometheus.MustRegister(holdersCount)
+	prometheus.MustRegister(utils.QuoteRequests)
+	prometheus.MustRegister(utils.UpstreamErrors)
+	prometheus.MustRegister(utils.RateLimitWait)
+	prometheus.MustRegister(utils.CacheRequests)
+	prometheus.MustRegister(watcherFailures)
+	prometheus.MustRegister(watcherRestarts)
 	r.Path("/metrics").Handler(promhttp.Handler())
 
 	srv := &http.Server{
@@ -92,3 +80,14 @@ func NewManager(address string, count prometheus.Gauge, cache *redis.Client, con
 
 	return m
 }
+
+// Shutdown stops every bot and waits for them to disconnect from discord. They are kept in the store to be restored on the next start.
+func (m *Manager) Shutdown() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.cancel()
+	for _, w := range m.watchers {
+		w.Shutdown()
+	}
+}
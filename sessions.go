@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SessionPool shares one discord session between every watcher using the same bot token
+type SessionPool struct {
+	sessions map[string]*pooledSession
+	sync.Mutex
+}
+
+// pooledSession is an open session and how many watchers are using it, ready is closed once it has been opened
+type pooledSession struct {
+	dg    *discordgo.Session
+	user  *discordgo.User
+	err   error
+	refs  int
+	ready chan struct{}
+}
+
+// NewSessionPool creates an empty pool
+func NewSessionPool() *SessionPool {
+	return &SessionPool{
+		sessions: make(map[string]*pooledSession),
+	}
+}
+
+// Acquire returns the session for a token, opening it if no other watcher is using it yet.
+// Every successful Acquire must be paired with a Release.
+func (p *SessionPool) Acquire(token string) (*discordgo.Session, *discordgo.User, error) {
+	p.Lock()
+	s, ok := p.sessions[token]
+	if ok {
+		s.refs++
+		p.Unlock()
+
+		<-s.ready
+		return s.dg, s.user, s.err
+	}
+
+	s = &pooledSession{refs: 1, ready: make(chan struct{})}
+	p.sessions[token] = s
+	p.Unlock()
+
+	s.dg, s.user, s.err = openSession(token)
+	if s.err != nil {
+		// let the next watcher try again
+		p.Lock()
+		delete(p.sessions, token)
+		p.Unlock()
+	}
+	close(s.ready)
+
+	return s.dg, s.user, s.err
+}
+
+// Release drops a watcher's hold on a session, closing it once no watcher is left
+func (p *SessionPool) Release(token string) {
+	p.Lock()
+	defer p.Unlock()
+
+	s, ok := p.sessions[token]
+	if !ok {
+		return
+	}
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+
+	delete(p.sessions, token)
+	if err := s.dg.Close(); err != nil {
+		logger.Errorf("Closing discord session: %s", err)
+	}
+}
+
+// openSession connects to discord and looks up who the bot is
+func openSession(token string) (*discordgo.Session, *discordgo.User, error) {
+
+	// create a new discord session using the provided bot token.
+	dg, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating discord session: %w", err)
+	}
+
+	// show as online
+	err = dg.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening discord connection: %w", err)
+	}
+
+	// get bot id
+	botUser, err := dg.User("@me")
+	if err != nil {
+		dg.Close()
+		return nil, nil, fmt.Errorf("getting bot id: %w", err)
+	}
+
+	return dg, botUser, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	kindTicker  = "ticker"
+	kindBoard   = "board"
+	kindGas     = "gas"
+	kindToken   = "token"
+	kindHolders = "holders"
+
+	redisStoreKey = "discord-stock-ticker#state"
+)
+
+// StoreEntry is a single persisted bot, the request used to create it
+type StoreEntry struct {
+	Kind    string          `json:"kind"`
+	ID      string          `json:"id"`
+	Request json.RawMessage `json:"request"`
+}
+
+// Store records the bots the manager is running so they can be restored on startup
+type Store interface {
+	Save(kind string, id string, request interface{}) error
+	Delete(kind string, id string) error
+	Load() ([]StoreEntry, error)
+}
+
+func storeKey(kind string, id string) string {
+	return fmt.Sprintf("%s/%s", kind, id)
+}
+
+func newStoreEntry(kind string, id string, request interface{}) (StoreEntry, error) {
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return StoreEntry{}, err
+	}
+
+	return StoreEntry{
+		Kind:    kind,
+		ID:      id,
+		Request: raw,
+	}, nil
+}
+
+// FileStore keeps the state in a json file on disk
+type FileStore struct {
+	path    string
+	entries map[string]StoreEntry
+	sync.Mutex
+}
+
+// NewFileStore opens (or creates on first write) the state file at path
+func NewFileStore(path string) (*FileStore, error) {
+	f := &FileStore{
+		path:    path,
+		entries: make(map[string]StoreEntry),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []StoreEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("reading state file %s: %w", path, err)
+	}
+
+	for _, e := range entries {
+		f.entries[storeKey(e.Kind, e.ID)] = e
+	}
+
+	return f, nil
+}
+
+// Save records a bot in the state file
+func (f *FileStore) Save(kind string, id string, request interface{}) error {
+	f.Lock()
+	defer f.Unlock()
+
+	entry, err := newStoreEntry(kind, id, request)
+	if err != nil {
+		return err
+	}
+	f.entries[storeKey(kind, id)] = entry
+
+	return f.flush()
+}
+
+// Delete removes a bot from the state file
+func (f *FileStore) Delete(kind string, id string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	delete(f.entries, storeKey(kind, id))
+
+	return f.flush()
+}
+
+// Load returns every bot in the state file
+func (f *FileStore) Load() ([]StoreEntry, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	entries := make([]StoreEntry, 0, len(f.entries))
+	for _, e := range f.entries {
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// flush writes the state to a temp file and moves it into place so a crash never leaves a partial file
+func (f *FileStore) flush() error {
+	entries := make([]StoreEntry, 0, len(f.entries))
+	for _, e := range f.entries {
+		entries = append(entries, e)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// the state contains discord tokens, keep it private
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// RedisStore keeps the state in a redis hash
+type RedisStore struct {
+	client  *redis.Client
+	context context.Context
+}
+
+// NewRedisStore uses the given redis client to hold state
+func NewRedisStore(client *redis.Client, context context.Context) *RedisStore {
+	return &RedisStore{
+		client:  client,
+		context: context,
+	}
+}
+
+// Save records a bot in redis
+func (r *RedisStore) Save(kind string, id string, request interface{}) error {
+	entry, err := newStoreEntry(kind, id, request)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return r.client.HSet(r.context, redisStoreKey, storeKey(kind, id), raw).Err()
+}
+
+// Delete removes a bot from redis
+func (r *RedisStore) Delete(kind string, id string) error {
+	return r.client.HDel(r.context, redisStoreKey, storeKey(kind, id)).Err()
+}
+
+// Load returns every bot in redis
+func (r *RedisStore) Load() ([]StoreEntry, error) {
+	values, err := r.client.HGetAll(r.context, redisStoreKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]StoreEntry, 0, len(values))
+	for key, raw := range values {
+		var e StoreEntry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			logger.Errorf("Skipping bad state entry %s: %s", key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// persist records a successfully added bot, if we have a store
+func (m *Manager) persist(kind string, id string, request interface{}) {
+	if m.Store == nil {
+		return
+	}
+
+	if err := m.Store.Save(kind, id, request); err != nil {
+		logger.Errorf("Saving %s %s to store: %s", kind, id, err)
+	}
+}
+
+// forget removes a deleted bot, if we have a store
+func (m *Manager) forget(kind string, id string) {
+	if m.Store == nil {
+		return
+	}
+
+	if err := m.Store.Delete(kind, id); err != nil {
+		logger.Errorf("Removing %s %s from store: %s", kind, id, err)
+	}
+}
+
+// restore re-creates every bot found in the store
+func (m *Manager) restore() {
+	if m.Store == nil {
+		return
+	}
+
+	entries, err := m.Store.Load()
+	if err != nil {
+		logger.Errorf("Loading state: %s", err)
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, e := range entries {
+		var err error
+
+		if k, ok := kinds[e.Kind]; ok {
+			req := k.NewRequest()
+			if err = json.Unmarshal(e.Request, req); err == nil {
+				if err = req.validate(); err == nil {
+					m.start(k, req)
+				}
+			}
+		} else {
+			err = fmt.Errorf("unknown kind")
+		}
+
+		if err != nil {
+			logger.Errorf("Restoring %s %s: %s", e.Kind, e.ID, err)
+			continue
+		}
+		logger.Infof("Restored %s %s", e.Kind, e.ID)
+	}
+}
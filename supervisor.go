@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	restartBaseDelay = 5 * time.Second
+	restartMaxDelay  = 5 * time.Minute
+)
+
+var (
+	watcherFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "watcher_failures_total",
+			Help: "Number of times a bot stopped on its own.",
+		},
+		[]string{"kind"},
+	)
+	watcherRestarts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "watcher_restarts_total",
+			Help: "Number of times a failed bot was restarted.",
+		},
+		[]string{"kind"},
+	)
+)
+
+// supervise waits for a watcher to exit and, if it failed while still registered, restarts it after a backoff.
+// Watchers only fail when they cannot connect to discord, so the backoff grows until a connection works.
+func (m *Manager) supervise(k *Kind, key string, w Watcher) {
+	<-w.base().done
+
+	status := w.Status()
+	if status.State != stateFailed {
+		return
+	}
+	watcherFailures.WithLabelValues(k.Name).Inc()
+
+	failures := w.base().failures + 1
+	delay := backoff(failures)
+	logger.Warnf("Restarting %s in %s after failure: %s", key, delay.Round(time.Second), status.Error)
+
+	select {
+	case <-time.After(delay):
+	case <-m.ctx.Done():
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	// the bot was removed or replaced while we waited
+	if m.watchers[key] != w {
+		return
+	}
+
+	restarted := k.NewWatcher(m, w.Config())
+	base := restarted.base()
+	base.sessions = m.sessions
+	base.failures = failures
+	base.status.Restarts = status.Restarts + 1
+	base.status.LastError = status.LastError
+	restarted.Start(m.ctx)
+
+	m.watchers[key] = restarted
+	watcherRestarts.WithLabelValues(k.Name).Inc()
+	logger.Infof("Restarted %s, %d restarts so far", key, base.status.Restarts)
+
+	go m.supervise(k, key, restarted)
+}
+
+// backoff doubles the delay for every failure in a row, picking a random point in the upper half
+// so bots that failed together do not all retry together
+func backoff(failures int) time.Duration {
+	delay := restartMaxDelay
+	if failures < 16 {
+		delay = restartBaseDelay << (failures - 1)
+	}
+	if delay > restartMaxDelay {
+		delay = restartMaxDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
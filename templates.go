@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rssnyder/discord-stock-ticker/utils"
+)
+
+// Display is what nickname_template and activity_template are evaluated against.
+// Every bot fills in the fields that make sense for it and leaves the rest empty.
+type Display struct {
+	// Name is the display name of the bot or board item
+	Name string
+	// Symbol is the ticker symbol of the stock or coin
+	Symbol string
+	// Price is the formatted price, without the currency symbol
+	Price string
+	// CurrencySymbol goes in front of Price, it is empty when Price is shown in cents or in Unit
+	CurrencySymbol string
+	// Unit is the small unit of a quote asset Price is shown in, like sats or gwei
+	Unit string
+	// Change is the formatted price change
+	Change string
+	// Percent is the formatted percent change, without the % sign
+	Percent string
+	// FullPrice, FullChange and FullPercent have the currency symbol or percent sign where the locale of the bot puts them
+	FullPrice   string
+	FullChange  string
+	FullPercent string
+	// Stale is true when the price was converted with an exchange rate that could not be refreshed
+	Stale bool
+	// Decorator is the arrow, or the custom decorator of the bot
+	Decorator string
+	// Increase is true when the price went up
+	Increase bool
+	// MarketState is the trading session of a stock: PRE, REGULAR, POST or CLOSED
+	MarketState string
+	// AfterHours is true outside of regular trading hours
+	AfterHours bool
+	// Volume is the formatted trading volume, when the provider has it
+	Volume string
+	// Header is the header of a board
+	Header string
+	// Percentage is true when a board shows the percent change instead of the price change
+	Percentage bool
+	// Instant, Fast and Standard are gas prices
+	Instant  int
+	Fast     int
+	Standard int
+	// Holders is the number of holders of a token
+	Holders string
+	// Quote is the unformatted quote, for templates that want to format numbers themselves
+	Quote utils.Quote
+
+	numbers *displayNumbers
+}
+
+// fmtVolume formats a trading volume, it is empty when the provider does not have one
+func fmtVolume(volume float64) string {
+	if volume == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(volume, 'f', 0, 64)
+}
+
+// money puts the currency symbol, or the unit, on a formatted price or change
+func (d Display) money(format utils.NumberFormat, number string) string {
+	if d.Unit != "" {
+		return number + " " + d.Unit
+	}
+	return format.Money(number, d.CurrencySymbol)
+}
+
+// parseTemplate compiles a display template, running it once so fields Display does not have are caught up front
+func parseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("display").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(ioutil.Discard, Display{}); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// mustTemplate compiles one of the default templates
+func mustTemplate(text string) *template.Template {
+	return template.Must(parseTemplate(text))
+}
+
+// template records a problem if a custom template does not compile
+func (v *validator) template(field string, text string) {
+	if text == "" {
+		return
+	}
+
+	_, err := parseTemplate(text)
+	v.check(err == nil, field, "is not a valid template: %v", err)
+}
+
+// setTemplates compiles the custom templates of a request, empty ones use the defaults of the bot
+func (w *watcher) setTemplates(nickname string, activity string) {
+	w.nicknameTemplate = nil
+	w.activityTemplate = nil
+
+	var err error
+	if nickname != "" {
+		if w.nicknameTemplate, err = parseTemplate(nickname); err != nil {
+			logger.Errorf("Unable to use nickname template: %s", err)
+		}
+	}
+	if activity != "" {
+		if w.activityTemplate, err = parseTemplate(activity); err != nil {
+			logger.Errorf("Unable to use activity template: %s", err)
+		}
+	}
+}
+
+// nickname renders the custom nickname template, or def if there is none, fitted to what discord allows
+func (w *watcher) nickname(def *template.Template, d Display) string {
+	return fit("nickname", maxNickname, func(d Display) string {
+		return render(w.nicknameTemplate, def, d)
+	}, d)
+}
+
+// activity renders the custom activity template, or def if there is none, fitted to what discord allows
+func (w *watcher) activity(def *template.Template, d Display) string {
+	return fit("activity", maxActivity, func(d Display) string {
+		return render(w.activityTemplate, def, d)
+	}, d)
+}
+
+// render executes custom, falling back to def when it is not set or fails
+func render(custom *template.Template, def *template.Template, d Display) string {
+	var b strings.Builder
+
+	if custom != nil {
+		err := custom.Execute(&b, d)
+		if err == nil {
+			return b.String()
+		}
+		logger.Errorf("Unable to render template: %s", err)
+		b.Reset()
+	}
+
+	if err := def.Execute(&b, d); err != nil {
+		logger.Errorf("Unable to render default template: %s", err)
+	}
+
+	return b.String()
+}
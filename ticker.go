@@ -2,126 +2,162 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"math"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
-	"github.com/go-redis/redis/v8"
-
 	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
+var (
+	// default display formats of tickers, the status ones are the activity of tickers that do not set their nickname
+	tickerNickname = mustTemplate("{{.Name}} {{.Decorator}} {{.FullPrice}}{{if .Stale}}*{{end}}")
+	tickerActivity = mustTemplate("{{.FullChange}} ({{.FullPercent}})")
+	stockStatus    = mustTemplate("{{.Price}}{{if .Stale}}*{{end}} {{.Decorator}} {{.FullPercent}}")
+	cryptoActivity = mustTemplate("{{.Change}} ({{.FullPercent}})")
+	cryptoStatus   = mustTemplate("{{.FullPrice}} {{.Decorator}} {{.FullPercent}}")
+)
+
 type Ticker struct {
-	Ticker         string          `json:"ticker"`
-	Name           string          `json:"name"`
-	Nickname       bool            `json:"nickname"`
-	Frequency      time.Duration   `json:"frequency"`
-	Color          bool            `json:"color"`
-	Decorator      string          `json:"decorator"`
-	Currency       string          `json:"currency"`
-	CurrencySymbol string          `json:"currency_symbol"`
-	Decimals       int             `json:"decimals"`
-	Activity       string          `json:"activity"`
-	Bitcoin        bool            `json:"bitcoin"`
-	Cache          *redis.Client   `json:"-"`
-	Context        context.Context `json:"-"`
-	token          string          `json:"-"`
-	close          chan int        `json:"-"`
+	Ticker         string             `json:"ticker"`
+	Crypto         bool               `json:"crypto"`
+	Name           string             `json:"name"`
+	Nickname       bool               `json:"nickname"`
+	Frequency      time.Duration      `json:"frequency"`
+	Color          bool               `json:"color"`
+	Decorator      string             `json:"decorator"`
+	Currency       string             `json:"currency"`
+	CurrencySymbol string             `json:"currency_symbol"`
+	Format         utils.NumberFormat `json:"format"`
+	Decimals       int                `json:"decimals"`
+	Activity       string             `json:"activity"`
+	Bitcoin        bool               `json:"bitcoin"`
+	QuoteAsset     string             `json:"quote_asset"`
+	Provider       string             `json:"provider"`
+	// pricedIn is the currency coingecko prices a crypto in, see pricedIn
+	pricedIn string
+	watcher
 }
 
-// NewStock saves information about the stock and starts up a watcher on it
-func NewStock(ticker string, token string, name string, nickname bool, color bool, decorator string, frequency int, currency string, activity string, decimals int) *Ticker {
+// NewStock saves information about the stock to watch
+func NewStock(ticker string, token string, name string, nickname bool, color bool, decorator string, frequency int, currency string, activity string, format utils.NumberFormat, currencySymbol string, provider string) *Ticker {
 	s := &Ticker{
-		Ticker:    ticker,
-		Name:      name,
-		Nickname:  nickname,
-		Color:     color,
-		Decorator: decorator,
-		Activity:  activity,
-		Decimals:  decimals,
-		Frequency: time.Duration(frequency) * time.Second,
-		Currency:  strings.ToUpper(currency),
-		token:     token,
-		close:     make(chan int, 1),
+		Ticker:         ticker,
+		Name:           name,
+		Nickname:       nickname,
+		Color:          color,
+		Decorator:      decorator,
+		Activity:       activity,
+		Format:         format,
+		Decimals:       format.Decimals,
+		Frequency:      time.Duration(frequency) * time.Second,
+		Currency:       strings.ToUpper(currency),
+		CurrencySymbol: currencySymbol,
+		Provider:       provider,
+		watcher:        newWatcher(token),
 	}
 
-	// spin off go routine to watch the price
-	go s.watchStockPrice()
 	return s
 }
 
-// NewCrypto saves information about the crypto and starts up a watcher on it
-func NewCrypto(ticker string, token string, name string, nickname bool, color bool, decorator string, frequency int, currency string, bitcoin bool, activity string, decimals int, currencySymbol string, cache *redis.Client, context context.Context) *Ticker {
+// NewCrypto saves information about the crypto to watch
+func NewCrypto(ticker string, token string, name string, nickname bool, color bool, decorator string, frequency int, currency string, quoteAsset string, activity string, format utils.NumberFormat, currencySymbol string, provider string) *Ticker {
 	s := &Ticker{
 		Ticker:         ticker,
+		Crypto:         true,
 		Name:           name,
 		Nickname:       nickname,
 		Color:          color,
 		Decorator:      decorator,
 		Activity:       activity,
-		Decimals:       decimals,
+		Format:         format,
+		Decimals:       format.Decimals,
 		Frequency:      time.Duration(frequency) * time.Second,
 		Currency:       strings.ToUpper(currency),
 		CurrencySymbol: currencySymbol,
-		Bitcoin:        bitcoin,
-		Cache:          cache,
-		Context:        context,
-		token:          token,
-		close:          make(chan int, 1),
+		Bitcoin:        quoteAsset == "btc",
+		QuoteAsset:     quoteAsset,
+		Provider:       provider,
+		pricedIn:       pricedIn(currency, quoteAsset),
+		watcher:        newWatcher(token),
 	}
 
-	// spin off go routine to watch the price
-	go s.watchCryptoPrice()
 	return s
 }
 
-// Shutdown sends a signal to shut off the goroutine
-func (s *Ticker) Shutdown() {
-	s.close <- 1
+// Start spins off a go routine to watch the price
+func (s *Ticker) Start(ctx context.Context) {
+	s.begin(ctx)
+	if s.Crypto {
+		go s.watchCryptoPrice()
+		return
+	}
+	go s.watchStockPrice()
 }
 
-func (s *Ticker) watchStockPrice() {
-	var exRate float64
+// Update changes the settings of the running ticker without reconnecting to discord
+func (s *Ticker) Update(req Request) error {
+	stockReq := req.(*TickerRequest)
+	old := s.request.(*TickerRequest)
 
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + s.token)
-	if err != nil {
-		logger.Errorf("Creating Discord session: %s", err)
-		return
+	if old.Token != stockReq.Token || old.Crypto != stockReq.Crypto || old.Currency != stockReq.Currency || old.QuoteAsset != stockReq.QuoteAsset {
+		return errRestartRequired
 	}
 
-	// show as online
-	err = dg.Open()
-	if err != nil {
-		logger.Errorf("Opening discord connection: %s", err)
-		return
+	return s.sendUpdate(stockReq)
+}
+
+// apply copies the settings that can change on the fly from a request, it is only called from the watching goroutine
+func (s *Ticker) apply(req *TickerRequest) {
+	if req.Crypto {
+		s.Ticker = strings.ToUpper(req.Ticker)
 	}
+	s.Name = req.Name
+	s.Nickname = req.Nickname
+	s.Color = req.Color
+	s.Decorator = req.Decorator
+	s.Activity = req.Activity
+	s.Format = req.format()
+	s.Decimals = s.Format.Decimals
+	s.Frequency = time.Duration(req.Frequency) * time.Second
+	s.CurrencySymbol = req.currencySymbol()
+	s.Provider = req.Provider
+	s.setTemplates(req.NicknameTemplate, req.ActivityTemplate)
+}
 
-	// get bot id
-	botUser, err := dg.User("@me")
+// quote fetches the price of a symbol from the provider the ticker is set to use, giving up when the ticker is stopped
+func (s *Ticker) quote(symbol string) (utils.Quote, error) {
+	provider, err := utils.GetProvider(s.Provider)
 	if err != nil {
-		logger.Errorf("Getting bot id: %s", err)
-		return
+		return utils.Quote{}, err
 	}
 
-	// Get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
-	if err != nil {
-		logger.Errorf("Getting guilds: %s", err)
-		s.Nickname = false
+	return provider.GetQuote(s.ctx, symbol)
+}
+
+// coin is the symbol of a crypto ticker, coingecko prices it in the currency or quote asset of the ticker directly
+func (s *Ticker) coin() string {
+	if s.Provider == "coingecko" {
+		return utils.CoinSymbol(s.Name, s.pricedIn)
 	}
+	return s.Name
+}
 
-	// If other currency, get rate
-	if s.Currency != "USD" {
-		exData, err := utils.GetStockPrice(s.Currency + "=X")
-		if err != nil {
-			logger.Errorf("Unable to fetch exchange rate for %s, default to USD.", s.Currency)
-		} else {
-			exRate = exData.QuoteSummary.Results[0].Price.RegularMarketPrice.Raw
-		}
+// pricedIn is what a crypto is priced in, its quote asset when it has one and its currency otherwise
+func pricedIn(currency string, quoteAsset string) string {
+	if quoteAsset != "" {
+		return quoteAsset
+	}
+	return strings.ToLower(currency)
+}
+
+func (s *Ticker) watchStockPrice() {
+	defer s.exit()
+
+	dg, botUser, err := s.connect()
+	if err != nil {
+		logger.Errorf("Connecting to discord for %s: %s", s.Name, err)
+		return
 	}
 
 	// Set arrows if no custom decorator
@@ -144,46 +180,52 @@ func (s *Ticker) watchStockPrice() {
 	// continuously watch
 	for {
 		select {
-		case <-s.close:
+		case <-s.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", s.Name)
 			return
+		case u := <-s.update:
+			s.apply(u.request.(*TickerRequest))
+
+			arrows = s.Decorator == ""
+			custom_activity = nil
+			itr = 0
+			itrSeed = 0.0
+			if s.Activity != "" {
+				custom_activity = strings.Split(s.Activity, ";")
+			}
+			ticker.Reset(s.Frequency)
+
+			logger.Infof("Updated settings for %s", s.Name)
+			close(u.applied)
 		case <-ticker.C:
 			logger.Debugf("Fetching stock price for %s", s.Name)
 
-			var priceData utils.PriceResults
 			var fmtPrice string
 			var fmtDiffPercent string
 			var fmtDiffChange string
 
-			// save the price struct & do something with it
-			priceData, err = utils.GetStockPrice(s.Ticker)
+			// save the quote & do something with it
+			quote, err := s.quote(s.Ticker)
 			if err != nil {
-				logger.Errorf("Unable to fetch stock price for %s", s.Name)
-			}
-
-			if len(priceData.QuoteSummary.Results) == 0 {
-				logger.Errorf("Yahoo returned bad data for %s", s.Name)
+				logger.Errorf("Unable to fetch stock price for %s: %s", s.Name, err)
 				continue
 			}
-			fmtPrice = priceData.QuoteSummary.Results[0].Price.RegularMarketPrice.Fmt
 
-			// Check if conversion is needed
-			if exRate != 0 {
-				rawPrice := exRate * priceData.QuoteSummary.Results[0].Price.RegularMarketPrice.Raw
-				fmtPrice = strconv.FormatFloat(rawPrice, 'f', 2, 64)
+			// Convert to the currency of the ticker, without a rate the price cannot be shown in it yet
+			rate, stale, err := utils.DefaultFXRates.Rate(s.ctx, quote.Currency, s.Currency)
+			if err != nil {
+				logger.Errorf("Unable to fetch exchange rate from %s to %s for %s: %s", quote.Currency, s.Currency, s.Name, err)
+				continue
+			} else if stale {
+				logger.Errorf("Exchange rate for %s is stale, showing %s with the last one", s.Currency, s.Name)
 			}
+			price := quote.Price * rate
+			change := quote.Change * rate
 
-			// check for day or after hours change
-			if priceData.QuoteSummary.Results[0].Price.MarketState == "POST" {
-				fmtDiffPercent = priceData.QuoteSummary.Results[0].Price.PostMarketChangePercent.Fmt
-				fmtDiffChange = priceData.QuoteSummary.Results[0].Price.PostMarketChange.Fmt
-			} else if priceData.QuoteSummary.Results[0].Price.MarketState == "PRE" {
-				fmtDiffPercent = priceData.QuoteSummary.Results[0].Price.PreMarketChangePercent.Fmt
-				fmtDiffChange = priceData.QuoteSummary.Results[0].Price.PreMarketChange.Fmt
-			} else {
-				fmtDiffPercent = priceData.QuoteSummary.Results[0].Price.RegularMarketChangePercent.Fmt
-				fmtDiffChange = priceData.QuoteSummary.Results[0].Price.RegularMarketChange.Fmt
-			}
+			format := s.Format.WithDecimals(2)
+			fmtPrice = format.Format(price)
+			fmtDiffPercent = s.Format.Fixed(2).Format(quote.ChangePercent)
+			fmtDiffChange = format.Format(change)
 
 			// calculate if price has moved up or down
 			var increase bool
@@ -202,17 +244,36 @@ func (s *Ticker) watchStockPrice() {
 				}
 			}
 
+			display := Display{
+				Name:           strings.ToUpper(s.Name),
+				Symbol:         s.Ticker,
+				Price:          fmtPrice,
+				CurrencySymbol: s.CurrencySymbol,
+				Change:         fmtDiffChange,
+				Percent:        fmtDiffPercent,
+				FullPrice:      s.Format.Money(fmtPrice, s.CurrencySymbol),
+				FullChange:     s.Format.Money(fmtDiffChange, s.CurrencySymbol),
+				FullPercent:    s.Format.Percent(fmtDiffPercent),
+				Stale:          stale,
+				Decorator:      s.Decorator,
+				Increase:       increase,
+				MarketState:    quote.MarketState,
+				AfterHours:     quote.MarketState == "PRE" || quote.MarketState == "POST",
+				Volume:         fmtVolume(quote.Volume),
+				Quote:          quote,
+			}.withNumbers(format, price, change)
+
 			if s.Nickname {
 				// update nickname instead of activity
 				var nickname string
 				var activity string
 
 				// format nickname & activity
-				nickname = fmt.Sprintf("%s %s %s%s", strings.ToUpper(s.Name), s.Decorator, s.CurrencySymbol, fmtPrice)
-				activity = fmt.Sprintf("%s%s (%s)", s.CurrencySymbol, fmtDiffChange, fmtDiffPercent)
+				nickname = s.nickname(tickerNickname, display)
+				activity = s.activity(tickerActivity, display)
 
 				// Update nickname in guilds
-				for _, g := range guilds {
+				for _, g := range s.guildList() {
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
 						logger.Errorf("Updating nickname: %s", err)
@@ -276,11 +337,11 @@ func (s *Ticker) watchStockPrice() {
 						itr = 0
 						itrSeed = 0.0
 					} else if math.Mod(itrSeed, 2.0) == 1.0 {
-						activity = custom_activity[itr]
+						activity = fitText("activity", maxActivity, custom_activity[itr])
 						itr++
 						itrSeed++
 					} else {
-						activity = custom_activity[itr]
+						activity = fitText("activity", maxActivity, custom_activity[itr])
 						itrSeed++
 					}
 				}
@@ -293,7 +354,7 @@ func (s *Ticker) watchStockPrice() {
 				}
 
 			} else {
-				activity := fmt.Sprintf("%s %s %s", fmtPrice, s.Decorator, fmtDiffPercent)
+				activity := s.activity(stockStatus, display)
 
 				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
@@ -311,47 +372,14 @@ func (s *Ticker) watchStockPrice() {
 }
 
 func (s *Ticker) watchCryptoPrice() {
-	var rdb *redis.Client
-	var exRate float64
-
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + s.token)
-	if err != nil {
-		logger.Errorf("Creating Discord session: %s", err)
-		return
-	}
+	defer s.exit()
 
-	// show as online
-	err = dg.Open()
+	dg, botUser, err := s.connect()
 	if err != nil {
-		logger.Errorf("Opening discord connection: %s", err)
+		logger.Errorf("Connecting to discord for %s: %s", s.Name, err)
 		return
 	}
 
-	// get bot id
-	botUser, err := dg.User("@me")
-	if err != nil {
-		logger.Errorf("Getting bot id: %s", err)
-		return
-	}
-
-	// Get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
-	if err != nil {
-		logger.Errorf("Getting guilds: %s", err)
-		s.Nickname = false
-	}
-
-	// If other currency, get rate
-	if s.Currency != "USD" {
-		exData, err := utils.GetStockPrice(s.Currency + "=X")
-		if err != nil {
-			logger.Errorf("Unable to fetch exchange rate for %s, default to USD.", s.Currency)
-		} else {
-			exRate = exData.QuoteSummary.Results[0].Price.RegularMarketPrice.Raw
-		}
-	}
-
 	// Set arrows if no custom decorator
 	var arrows bool
 	if s.Decorator == "" {
@@ -372,77 +400,74 @@ func (s *Ticker) watchCryptoPrice() {
 	// continuously watch
 	for {
 		select {
-		case <-s.close:
+		case <-s.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", s.Name)
 			return
+		case u := <-s.update:
+			s.apply(u.request.(*TickerRequest))
+
+			arrows = s.Decorator == ""
+			custom_activity = nil
+			itr = 0
+			itrSeed = 0.0
+			if s.Activity != "" {
+				custom_activity = strings.Split(s.Activity, ";")
+			}
+			ticker.Reset(s.Frequency)
+
+			logger.Infof("Updated settings for %s", s.Name)
+			close(u.applied)
 		case <-ticker.C:
 			logger.Debugf("Fetching crypto price for %s", s.Name)
 
-			var priceData utils.GeckoPriceResults
 			var fmtPrice string
 			var fmtChange string
-			var changeHeader string
 			var fmtDiffPercent string
 
-			// save the price struct & do something with it
-			if s.Cache == rdb {
-				priceData, err = utils.GetCryptoPrice(s.Name)
-			} else {
-				priceData, err = utils.GetCryptoPriceCache(s.Cache, s.Context, s.Name)
-			}
+			// save the quote & do something with it
+			quote, err := s.quote(s.coin())
 			if err != nil {
-				logger.Errorf("Unable to fetch stock price for %s: %s", s.Name, err)
+				logger.Errorf("Unable to fetch crypto price for %s: %s", s.Name, err)
+				continue
 			}
 
-			// Check if conversion is needed
-			if exRate != 0 {
-				priceData.MarketData.CurrentPrice.USD = exRate * priceData.MarketData.CurrentPrice.USD
-				priceData.MarketData.PriceChangeCurrency.USD = exRate * priceData.MarketData.PriceChangeCurrency.USD
-			}
+			fmtDiffPercent = s.Format.Fixed(2).Format(quote.ChangePercent)
+
+			fmtChange = s.Format.WithDecimals(2).Format(quote.Change)
 
-			fmtDiffPercent = fmt.Sprintf("%.2f", priceData.MarketData.PriceChangePercent)
-
-			fmtChange = fmt.Sprintf("%.2f", priceData.MarketData.PriceChangeCurrency.USD)
-
-			// Check for custom decimal places
-			switch s.Decimals {
-			case 1:
-				fmtPrice = fmt.Sprintf("%s%.1f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 2:
-				fmtPrice = fmt.Sprintf("%s%.2f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 3:
-				fmtPrice = fmt.Sprintf("%s%.3f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 4:
-				fmtPrice = fmt.Sprintf("%s%.4f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 5:
-				fmtPrice = fmt.Sprintf("%s%.5f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 6:
-				fmtPrice = fmt.Sprintf("%s%.6f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 7:
-				fmtPrice = fmt.Sprintf("%s%.7f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 8:
-				fmtPrice = fmt.Sprintf("%s%.8f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 9:
-				fmtPrice = fmt.Sprintf("%s%.9f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 10:
-				fmtPrice = fmt.Sprintf("%s%.10f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			case 11:
-				fmtPrice = fmt.Sprintf("%s%.11f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
-			default:
+			// Check for custom number formats
+			currencySymbol := s.CurrencySymbol
+			format := s.Format.WithDecimals(2)
+			if quote.Price < 1.0 {
+				format = s.Format.WithDecimals(3)
+			}
+			price, change := quote.Price, quote.Change
+			var unit string
+			asset, inAsset := utils.GetQuoteAsset(s.pricedIn)
+			inCents := !inAsset && utils.IsFiat(s.pricedIn) && s.Format.Default() && !s.Format.Subscript && quote.Price < 0.01
+			if inAsset {
+
+				// Coins priced in another coin are shown in it, or in its small unit like sats when they are worth little
+				var scale float64
+				scale, format, unit = asset.Scale(s.Format, quote.Price)
+				price, change = price*scale, change*scale
+				if unit != "" {
+					currencySymbol = ""
+				}
+				fmtPrice = format.Format(price)
+				fmtChange = format.Format(change)
+			} else if inCents {
 
 				// Check for cryptos below 1c
-				if priceData.MarketData.CurrentPrice.USD < 0.01 {
-					priceData.MarketData.CurrentPrice.USD = priceData.MarketData.CurrentPrice.USD * 100
-					if priceData.MarketData.CurrentPrice.USD < 0.00001 {
-						fmtPrice = fmt.Sprintf("%.8f¢", priceData.MarketData.CurrentPrice.USD)
-					} else {
-						fmtPrice = fmt.Sprintf("%.6f¢", priceData.MarketData.CurrentPrice.USD)
-					}
-				} else if priceData.MarketData.CurrentPrice.USD < 1.0 {
-					fmtPrice = fmt.Sprintf("%s%.3f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
+				currencySymbol = ""
+				cents := quote.Price * 100
+				if cents < 0.00001 {
+					fmtPrice = s.Format.Fixed(8).Format(cents) + "¢"
 				} else {
-					fmtPrice = fmt.Sprintf("%s%.2f", s.CurrencySymbol, priceData.MarketData.CurrentPrice.USD)
+					fmtPrice = s.Format.Fixed(6).Format(cents) + "¢"
 				}
+			} else {
+				fmtPrice = format.Format(quote.Price)
 			}
 
 			// calculate if price has moved up or down
@@ -462,24 +487,40 @@ func (s *Ticker) watchCryptoPrice() {
 				}
 			}
 
+			display := Display{
+				Name:           quote.Symbol,
+				Symbol:         quote.Symbol,
+				Price:          fmtPrice,
+				CurrencySymbol: currencySymbol,
+				Unit:           unit,
+				Change:         fmtChange,
+				Percent:        fmtDiffPercent,
+				FullPercent:    s.Format.Percent(fmtDiffPercent),
+				Decorator:      s.Decorator,
+				Increase:       increase,
+				Volume:         fmtVolume(quote.Volume),
+				Quote:          quote,
+			}
+			display.FullPrice = display.money(s.Format, fmtPrice)
+			display.FullChange = display.money(s.Format, fmtChange)
+			if s.Ticker != "" {
+				display.Name = s.Ticker
+			}
+			if !inCents {
+				display = display.withNumbers(format, price, change)
+			}
+
 			if s.Nickname {
 				// update nickname instead of activity
-				var displayName string
 				var nickname string
 				var activity string
 
-				if s.Ticker != "" {
-					displayName = s.Ticker
-				} else {
-					displayName = strings.ToUpper(priceData.Symbol)
-				}
-
 				// format nickname
-				nickname = fmt.Sprintf("%s %s %s", displayName, s.Decorator, fmtPrice)
-				activity = fmt.Sprintf("%s%s (%s%%)", changeHeader, fmtChange, fmtDiffPercent)
+				nickname = s.nickname(tickerNickname, display)
+				activity = s.activity(cryptoActivity, display)
 
 				// Update nickname in guilds
-				for _, g := range guilds {
+				for _, g := range s.guildList() {
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
 						logger.Errorf("Updating nickname: %s", err)
@@ -543,11 +584,11 @@ func (s *Ticker) watchCryptoPrice() {
 						itr = 0
 						itrSeed = 0.0
 					} else if math.Mod(itrSeed, 2.0) == 1.0 {
-						activity = custom_activity[itr]
+						activity = fitText("activity", maxActivity, custom_activity[itr])
 						itr++
 						itrSeed++
 					} else {
-						activity = custom_activity[itr]
+						activity = fitText("activity", maxActivity, custom_activity[itr])
 						itrSeed++
 					}
 				}
@@ -562,7 +603,7 @@ func (s *Ticker) watchCryptoPrice() {
 			} else {
 
 				// format activity
-				activity := fmt.Sprintf("%s %s %s%%", fmtPrice, s.Decorator, fmtDiffPercent)
+				activity := s.activity(cryptoStatus, display)
 				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
 					logger.Errorf("Unable to set activity: %s", err)
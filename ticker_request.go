@@ -1,171 +1,156 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
 	"strings"
 
-	"github.com/gorilla/mux"
+	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
 // TickerRequest represents the json coming in from the request
 type TickerRequest struct {
-	Ticker         string `json:"ticker"`
-	Token          string `json:"discord_bot_token"`
-	Name           string `json:"name"`
-	Nickname       bool   `json:"set_nickname"`
-	Crypto         bool   `json:"crypto"`
-	Color          bool   `json:"set_color"`
-	Decorator      string `json:"decorator"`
-	Frequency      int    `json:"frequency"`
-	Currency       string `json:"currency"`
-	CurrencySymbol string `json:"currency_symbol"`
-	Bitcoin        bool   `json:"bitcoin"`
-	Activity       string `json:"activity"`
-	Decimals       int    `json:"decimals"`
+	Ticker              string `json:"ticker"`
+	Token               string `json:"discord_bot_token"`
+	Name                string `json:"name"`
+	Nickname            bool   `json:"set_nickname"`
+	Crypto              bool   `json:"crypto"`
+	Color               bool   `json:"set_color"`
+	Decorator           string `json:"decorator"`
+	Frequency           int    `json:"frequency"`
+	Currency            string `json:"currency"`
+	CurrencySymbol      string `json:"currency_symbol"`
+	Bitcoin             bool   `json:"bitcoin"`
+	QuoteAsset          string `json:"quote_asset"`
+	Activity            string `json:"activity"`
+	Decimals            int    `json:"decimals"`
+	SignificantDigits   int    `json:"significant_digits"`
+	Compact             bool   `json:"compact"`
+	SubscriptZeros      bool   `json:"subscript_zeros"`
+	ThousandsSeparators bool   `json:"thousands_separators"`
+	TrimZeros           bool   `json:"trim_zeros"`
+	Locale              string `json:"locale"`
+	Provider            string `json:"provider"`
+	NicknameTemplate    string `json:"nickname_template"`
+	ActivityTemplate    string `json:"activity_template"`
 }
 
-// AddTicker adds a new Ticker or crypto to the list of what to watch
-func (m *Manager) AddTicker(w http.ResponseWriter, r *http.Request) {
-	m.Lock()
-	defer m.Unlock()
+func init() {
+	registerKind(&Kind{
+		Name:       kindTicker,
+		Path:       "/ticker",
+		UpperID:    true,
+		Count:      tickerCount,
+		NewRequest: func() Request { return &TickerRequest{} },
+		NewWatcher: newTickerWatcher,
+	})
+}
 
-	logger.Debugf("Got an API request to add a ticker")
+// newTickerWatcher creates a stock or crypto ticker from a validated request
+func newTickerWatcher(m *Manager, req Request) Watcher {
+	stockReq := req.(*TickerRequest)
 
-	// read body
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		logger.Errorf("%s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	var ticker *Ticker
+	if stockReq.Crypto {
+		ticker = NewCrypto(stockReq.Ticker, stockReq.Token, stockReq.Name, stockReq.Nickname, stockReq.Color, stockReq.Decorator, stockReq.Frequency, stockReq.Currency, stockReq.QuoteAsset, stockReq.Activity, stockReq.format(), stockReq.currencySymbol(), stockReq.Provider)
+	} else {
+		ticker = NewStock(stockReq.Ticker, stockReq.Token, stockReq.Name, stockReq.Nickname, stockReq.Color, stockReq.Decorator, stockReq.Frequency, stockReq.Currency, stockReq.Activity, stockReq.format(), stockReq.CurrencySymbol, stockReq.Provider)
 	}
+	ticker.Ticker = strings.ToUpper(ticker.Ticker)
+	ticker.request = stockReq
+	ticker.setTemplates(stockReq.NicknameTemplate, stockReq.ActivityTemplate)
 
-	// unmarshal into struct
-	var stockReq TickerRequest
-	if err := json.Unmarshal(body, &stockReq); err != nil {
-		logger.Errorf("Unmarshalling: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	return ticker
+}
 
-	// ensure token is set
-	if stockReq.Token == "" {
-		logger.Error("Discord token required")
-		w.WriteHeader(http.StatusBadRequest)
-		return
+// validate fills in defaults and ensures the request can be used to start a ticker
+func (stockReq *TickerRequest) validate() error {
+	var v validator
+
+	v.require("discord_bot_token", stockReq.Token)
+	v.template("nickname_template", stockReq.NicknameTemplate)
+	v.template("activity_template", stockReq.ActivityTemplate)
+	v.frequency(&stockReq.Frequency)
+	v.format(stockReq.format())
+
+	// ensure currency is set for cryptos, stocks are shown in the currency they trade in unless one is asked for
+	if stockReq.Crypto {
+		if stockReq.Currency == "" {
+			stockReq.Currency = "usd"
+		}
+		v.check(coinCurrencyPattern.MatchString(stockReq.Currency), "currency", "must be a currency coingecko prices coins in, like eur or btc")
+	} else if stockReq.Currency != "" {
+		v.check(currencyPattern.MatchString(stockReq.Currency), "currency", "must be a three letter currency code")
 	}
 
-	// ensure currency is set
-	if stockReq.Currency == "" {
-		stockReq.Currency = "usd"
+	// ensure provider is set, cryptos come from coingecko and stocks from yahoo by default
+	if stockReq.Provider == "" {
+		stockReq.Provider = "yahoo"
+		if stockReq.Crypto {
+			stockReq.Provider = "coingecko"
+		}
 	}
+	v.oneOf("provider", stockReq.Provider, utils.Providers())
 
-	// add stock or crypto ticker
 	if stockReq.Crypto {
 
 		// ensure name is set
-		if stockReq.Name == "" {
-			logger.Error("Name required for crypto")
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+		v.require("name", stockReq.Name)
 
-		// ensure currency is set
-		if stockReq.CurrencySymbol == "" {
-			stockReq.CurrencySymbol = "$"
+		// bitcoin is the older way of pricing a coin in btc, it is folded into the quote asset so
+		// clearing quote_asset prices the coin in its currency again
+		stockReq.QuoteAsset = strings.ToLower(stockReq.QuoteAsset)
+		if stockReq.Bitcoin && stockReq.QuoteAsset == "" {
+			stockReq.QuoteAsset = "btc"
 		}
-
-		// check if already existing
-		if _, ok := m.WatchingTicker[strings.ToUpper(stockReq.Name)]; ok {
-			logger.Error("Ticker already exists")
-			w.WriteHeader(http.StatusConflict)
-			return
+		stockReq.Bitcoin = false
+		if stockReq.QuoteAsset != "" {
+			v.oneOf("quote_asset", stockReq.QuoteAsset, utils.QuoteAssets())
+			v.check(stockReq.Provider == "coingecko", "quote_asset", "needs the coingecko provider")
 		}
 
-		crypto := NewCrypto(stockReq.Ticker, stockReq.Token, stockReq.Name, stockReq.Nickname, stockReq.Color, stockReq.Decorator, stockReq.Frequency, stockReq.Currency, stockReq.Bitcoin, stockReq.Activity, stockReq.Decimals, stockReq.CurrencySymbol, m.Cache, m.Context)
-		m.addTicker(stockReq.Name, crypto)
-
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(crypto)
-		if err != nil {
-			logger.Errorf("Unable to encode ticker: %s", err)
-			w.WriteHeader(http.StatusBadRequest)
-		}
-		return
+		return v.err()
 	}
 
 	// ensure ticker is set
-	if stockReq.Ticker == "" {
-		logger.Error("Ticker required")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+	v.require("ticker", stockReq.Ticker)
+	v.check(stockReq.QuoteAsset == "", "quote_asset", "is only for crypto tickers")
 
 	// ensure name is set
 	if stockReq.Name == "" {
 		stockReq.Name = stockReq.Ticker
 	}
 
-	// check if already existing
-	if _, ok := m.WatchingTicker[strings.ToUpper(stockReq.Ticker)]; ok {
-		logger.Error("Ticker already exists")
-		w.WriteHeader(http.StatusConflict)
-		return
-	}
-
-	stock := NewStock(stockReq.Ticker, stockReq.Token, stockReq.Name, stockReq.Nickname, stockReq.Color, stockReq.Decorator, stockReq.Frequency, stockReq.Currency, stockReq.Activity, stockReq.Decimals)
-	m.addTicker(stockReq.Ticker, stock)
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(stock)
-	if err != nil {
-		logger.Errorf("Unable to encode ticker: %s", err)
-		w.WriteHeader(http.StatusBadRequest)
-	}
+	return v.err()
 }
 
-func (m *Manager) addTicker(ticker string, stock *Ticker) {
-	tickerCount.Inc()
-	stock.Ticker = strings.ToUpper(stock.Ticker)
-	m.WatchingTicker[strings.ToUpper(ticker)] = stock
+// id is the key the ticker is watched under
+func (stockReq TickerRequest) id() string {
+	if stockReq.Crypto {
+		return strings.ToUpper(stockReq.Name)
+	}
+	return strings.ToUpper(stockReq.Ticker)
 }
 
-// DeleteTicker addds a new Ticker or crypto to the list of what to watch
-func (m *Manager) DeleteTicker(w http.ResponseWriter, r *http.Request) {
-	m.Lock()
-	defer m.Unlock()
-
-	logger.Debugf("Got an API request to delete a ticker")
-
-	vars := mux.Vars(r)
-	id := strings.ToUpper(vars["id"])
-
-	if _, ok := m.WatchingTicker[id]; !ok {
-		logger.Errorf("No ticker found: %s", id)
-		w.WriteHeader(http.StatusNotFound)
-		return
+// currencySymbol is the symbol prices are shown with. Cryptos without one use the symbol of
+// what they are priced in when it is a quote asset, and $ otherwise.
+func (stockReq TickerRequest) currencySymbol() string {
+	if stockReq.CurrencySymbol != "" || !stockReq.Crypto {
+		return stockReq.CurrencySymbol
 	}
-	// send shutdown sign
-	m.WatchingTicker[id].Shutdown()
-	tickerCount.Dec()
-
-	// remove from cache
-	delete(m.WatchingTicker, id)
-
-	logger.Infof("Deleted ticker %s", id)
-	w.WriteHeader(http.StatusNoContent)
+	if asset, ok := utils.GetQuoteAsset(pricedIn(stockReq.Currency, stockReq.QuoteAsset)); ok {
+		return asset.Symbol
+	}
+	return "$"
 }
 
-// GetTickers returns a list of what the manager is watching
-func (m *Manager) GetTickers(w http.ResponseWriter, r *http.Request) {
-	m.RLock()
-	defer m.RUnlock()
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(m.WatchingTicker); err != nil {
-		logger.Errorf("Serving request: %s", err)
+// format is how the ticker shows numbers
+func (stockReq TickerRequest) format() utils.NumberFormat {
+	return utils.NumberFormat{
+		Decimals:    stockReq.Decimals,
+		Significant: stockReq.SignificantDigits,
+		Compact:     stockReq.Compact,
+		Subscript:   stockReq.SubscriptZeros,
+		Separators:  stockReq.ThousandsSeparators,
+		Trim:        stockReq.TrimZeros,
+		Locale:      stockReq.Locale,
 	}
 }
@@ -1,34 +1,37 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"math"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
-
 	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
+var (
+	// default display formats of tokens, tokens that do not set their nickname show the nickname as their activity
+	tokenNickname = mustTemplate("{{.Name}} {{.Decorator}} {{.FullPrice}}")
+	tokenActivity = mustTemplate("Using USDC on 1inch")
+)
+
 type Token struct {
-	Network   string        `json:"network"`
-	Contract  string        `json:"contract"`
-	Name      string        `json:"name"`
-	Nickname  bool          `json:"nickname"`
-	Frequency time.Duration `json:"frequency"`
-	Color     bool          `json:"color"`
-	Decorator string        `json:"decorator"`
-	Decimals  int           `json:"decimals"`
-	Activity  string        `json:"activity"`
-	Source    string        `json:"source"`
-	token     string        `json:"-"`
-	close     chan int      `json:"-"`
+	Network   string             `json:"network"`
+	Contract  string             `json:"contract"`
+	Name      string             `json:"name"`
+	Nickname  bool               `json:"nickname"`
+	Frequency time.Duration      `json:"frequency"`
+	Color     bool               `json:"color"`
+	Decorator string             `json:"decorator"`
+	Format    utils.NumberFormat `json:"format"`
+	Decimals  int                `json:"decimals"`
+	Activity  string             `json:"activity"`
+	Source    string             `json:"source"`
+	watcher
 }
 
-// NewToken saves information about the stock and starts up a watcher on it
-func NewToken(network string, contract string, token string, name string, nickname bool, frequency int, decimals int, activity string, color bool, decorator string, source string) *Token {
+// NewToken saves information about the token to watch
+func NewToken(network string, contract string, token string, name string, nickname bool, frequency int, format utils.NumberFormat, activity string, color bool, decorator string, source string) *Token {
 	m := &Token{
 		Network:   network,
 		Contract:  contract,
@@ -37,50 +40,54 @@ func NewToken(network string, contract string, token string, name string, nickna
 		Frequency: time.Duration(frequency) * time.Second,
 		Color:     color,
 		Decorator: decorator,
+		Format:    format,
+		Decimals:  format.Decimals,
 		Activity:  activity,
 		Source:    source,
-		token:     token,
-		close:     make(chan int, 1),
+		watcher:   newWatcher(token),
 	}
 
-	// spin off go routine to watch the price
-	go m.watchTokenPrice()
 	return m
 }
 
-// Shutdown sends a signal to shut off the goroutine
-func (m *Token) Shutdown() {
-	m.close <- 1
+// Start spins off a go routine to watch the price
+func (m *Token) Start(ctx context.Context) {
+	m.begin(ctx)
+	go m.watchTokenPrice()
 }
 
-func (m *Token) watchTokenPrice() {
+// Update changes the settings of the running token watcher without reconnecting to discord
+func (m *Token) Update(req Request) error {
+	tokenReq := req.(*TokenRequest)
+	old := m.request.(*TokenRequest)
 
-	// create a new discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + m.token)
-	if err != nil {
-		fmt.Println("Error creating Discord session: ", err)
-		return
+	if old.Token != tokenReq.Token || old.Source != tokenReq.Source {
+		return errRestartRequired
 	}
 
-	// show as online
-	err = dg.Open()
-	if err != nil {
-		fmt.Println("error opening discord connection,", err)
-		return
-	}
+	return m.sendUpdate(tokenReq)
+}
 
-	// get bot id
-	botUser, err := dg.User("@me")
-	if err != nil {
-		logger.Errorf("Getting bot id: %s", err)
-		return
-	}
+// apply copies the settings that can change on the fly from a request, it is only called from the watching goroutine
+func (m *Token) apply(req *TokenRequest) {
+	m.Name = req.Name
+	m.Nickname = req.Nickname
+	m.Frequency = time.Duration(req.Frequency) * time.Second
+	m.Color = req.Color
+	m.Decorator = req.Decorator
+	m.Format = req.format()
+	m.Decimals = m.Format.Decimals
+	m.Activity = req.Activity
+	m.setTemplates(req.NicknameTemplate, req.ActivityTemplate)
+}
+
+func (m *Token) watchTokenPrice() {
+	defer m.exit()
 
-	// Get guides for bot
-	guilds, err := dg.UserGuilds(100, "", "")
+	dg, botUser, err := m.connect()
 	if err != nil {
-		fmt.Println("Error getting guilds: ", err)
-		m.Nickname = false
+		logger.Errorf("Connecting to discord for %s: %s", m.Name, err)
+		return
 	}
 
 	// Set arrows if no custom decorator
@@ -104,48 +111,40 @@ func (m *Token) watchTokenPrice() {
 	var oldPrice float64
 	for {
 		select {
-		case <-m.close:
+		case <-m.ctx.Done():
 			logger.Infof("Shutting down price watching for %s", m.Name)
 			return
+		case u := <-m.update:
+			m.apply(u.request.(*TokenRequest))
+
+			arrows = m.Decorator == ""
+			custom_activity = nil
+			itr = 0
+			itrSeed = 0.0
+			if m.Activity != "" {
+				custom_activity = strings.Split(m.Activity, ";")
+			}
+			ticker.Reset(m.Frequency)
+
+			logger.Infof("Updated settings for %s", m.Name)
+			close(u.applied)
 		case <-ticker.C:
 			logger.Infof("Fetching stock price for %s", m.Name)
-			var priceData string
-			var fmtPriceRaw float64
 			var fmtPrice float64
 
-			switch m.Source {
-			case "pancakeswap":
-				logger.Infof("Using %s to get price: %s", m.Source, m.Name)
-
-				// Get price from Ps in BNB
-				priceData, err = utils.GetPancakeTokenPrice(m.Contract)
-				if err != nil {
-					logger.Errorf("Unable to fetch token price from %s: %s", m.Source, m.Name)
-					continue
-				}
-
-				bnbRate, err := utils.GetCryptoPrice("binancecoin")
-				if err != nil {
-					logger.Errorf("Unable to fetch bnb price for %s", m.Name)
-					continue
-				}
-
-				if fmtPriceRaw, err = strconv.ParseFloat(priceData, 64); err != nil {
-					logger.Errorf("Error with price format for %s", m.Name)
-				}
-				fmtPrice = bnbRate.MarketData.CurrentPrice.USD * fmtPriceRaw
-
-			default:
-				priceData, err = utils.Get1inchTokenPrice(m.Network, m.Contract)
-				if err != nil {
-					logger.Errorf("Unable to fetch token price for %s", m.Name)
-				}
+			provider, err := utils.GetProvider(m.Source)
+			if err != nil {
+				logger.Errorf("Unable to fetch token price for %s: %s", m.Name, err)
+				continue
+			}
 
-				if fmtPriceRaw, err = strconv.ParseFloat(priceData, 64); err != nil {
-					logger.Errorf("Error with price format for %s", m.Name)
-				}
-				fmtPrice = fmtPriceRaw / 10000000
+			logger.Debugf("Using %s to get price: %s", m.Source, m.Name)
+			quote, err := provider.GetQuote(m.ctx, utils.TokenSymbol(m.Network, m.Contract))
+			if err != nil {
+				logger.Errorf("Unable to fetch token price from %s for %s: %s", m.Source, m.Name, err)
+				continue
 			}
+			fmtPrice = quote.Price
 
 			// calculate if price has moved up or down
 			var increase bool
@@ -162,47 +161,30 @@ func (m *Token) watchTokenPrice() {
 				}
 			}
 
+			display := Display{
+				Name:           m.Name,
+				Price:          m.Format.WithDecimals(4).Format(fmtPrice),
+				CurrencySymbol: "$",
+				Decorator:      m.Decorator,
+				Increase:       increase,
+				Quote:          quote,
+			}.withNumbers(m.Format.WithDecimals(4), fmtPrice, 0)
+			display.FullPrice = m.Format.Money(display.Price, display.CurrencySymbol)
+
 			if m.Nickname {
 				// update nickname instead of activity
 				var nickname string
 				var activity string
 
 				// format nickname & activity
-				// Check for custom decimal places
-				switch m.Decimals {
-				case 1:
-					nickname = fmt.Sprintf("%s %s $%.1f", m.Name, m.Decorator, fmtPrice)
-				case 2:
-					nickname = fmt.Sprintf("%s %s $%.2f", m.Name, m.Decorator, fmtPrice)
-				case 3:
-					nickname = fmt.Sprintf("%s %s $%.3f", m.Name, m.Decorator, fmtPrice)
-				case 4:
-					nickname = fmt.Sprintf("%s %s $%.4f", m.Name, m.Decorator, fmtPrice)
-				case 5:
-					nickname = fmt.Sprintf("%s %s $%.5f", m.Name, m.Decorator, fmtPrice)
-				case 6:
-					nickname = fmt.Sprintf("%s %s $%.6f", m.Name, m.Decorator, fmtPrice)
-				case 7:
-					nickname = fmt.Sprintf("%s %s $%.7f", m.Name, m.Decorator, fmtPrice)
-				case 8:
-					nickname = fmt.Sprintf("%s %s $%.8f", m.Name, m.Decorator, fmtPrice)
-				case 9:
-					nickname = fmt.Sprintf("%s %s $%.9f", m.Name, m.Decorator, fmtPrice)
-				case 10:
-					nickname = fmt.Sprintf("%s %s $%.10f", m.Name, m.Decorator, fmtPrice)
-				case 11:
-					nickname = fmt.Sprintf("%s %s $%.11f", m.Name, m.Decorator, fmtPrice)
-				default:
-					nickname = fmt.Sprintf("%s %s $%.4f", m.Name, m.Decorator, fmtPrice)
-				}
-
-				activity = "Using USDC on 1inch"
+				nickname = m.nickname(tokenNickname, display)
+				activity = m.activity(tokenActivity, display)
 
 				// Update nickname in guilds
-				for _, g := range guilds {
+				for _, g := range m.guildList() {
 					err = dg.GuildMemberNickname(g.ID, "@me", nickname)
 					if err != nil {
-						fmt.Println("Error updating nickname: ", err)
+						logger.Errorf("Updating nickname: %s", err)
 						continue
 					}
 					logger.Infof("Set nickname in %s: %s", g.Name, nickname)
@@ -263,11 +245,11 @@ func (m *Token) watchTokenPrice() {
 						itr = 0
 						itrSeed = 0.0
 					} else if math.Mod(itrSeed, 2.0) == 1.0 {
-						activity = custom_activity[itr]
+						activity = fitText("activity", maxActivity, custom_activity[itr])
 						itr++
 						itrSeed++
 					} else {
-						activity = custom_activity[itr]
+						activity = fitText("activity", maxActivity, custom_activity[itr])
 						itrSeed++
 					}
 				}
@@ -280,7 +262,9 @@ func (m *Token) watchTokenPrice() {
 				}
 
 			} else {
-				activity := fmt.Sprintf("%s %s $%.2f", m.Name, m.Decorator, fmtPrice)
+				display = display.withNumbers(m.Format.WithDecimals(2), fmtPrice, 0)
+				display.reformat(display.numbers.format)
+				activity := m.activity(tokenNickname, display)
 
 				err = dg.UpdateGameStatus(0, activity)
 				if err != nil {
@@ -1,139 +1,97 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"strings"
 
-	"github.com/gorilla/mux"
+	"github.com/rssnyder/discord-stock-ticker/utils"
 )
 
 // TokenRequest represents the json coming in from the request
 type TokenRequest struct {
-	Network   string `json:"network"`
-	Contract  string `json:"contract"`
-	Token     string `json:"discord_bot_token"`
-	Name      string `json:"name"`
-	Nickname  bool   `json:"set_nickname"`
-	Frequency int    `json:"frequency" default:"60"`
-	Color     bool   `json:"set_color"`
-	Decorator string `json:"decorator" default:"-"`
-	Activity  string `json:"activity"`
-	Decimals  int    `json:"decimals"`
-	Source    string `json:"source"`
+	Network             string `json:"network"`
+	Contract            string `json:"contract"`
+	Token               string `json:"discord_bot_token"`
+	Name                string `json:"name"`
+	Nickname            bool   `json:"set_nickname"`
+	Frequency           int    `json:"frequency" default:"60"`
+	Color               bool   `json:"set_color"`
+	Decorator           string `json:"decorator" default:"-"`
+	Activity            string `json:"activity"`
+	Decimals            int    `json:"decimals"`
+	SignificantDigits   int    `json:"significant_digits"`
+	Compact             bool   `json:"compact"`
+	SubscriptZeros      bool   `json:"subscript_zeros"`
+	ThousandsSeparators bool   `json:"thousands_separators"`
+	TrimZeros           bool   `json:"trim_zeros"`
+	Locale              string `json:"locale"`
+	Source              string `json:"source"`
+	NicknameTemplate    string `json:"nickname_template"`
+	ActivityTemplate    string `json:"activity_template"`
 }
 
-// AddToken adds a new Token or crypto to the list of what to watch
-func (m *Manager) AddToken(w http.ResponseWriter, r *http.Request) {
-	m.Lock()
-	defer m.Unlock()
+func init() {
+	registerKind(&Kind{
+		Name:       kindToken,
+		Path:       "/token",
+		Count:      tokenCount,
+		NewRequest: func() Request { return &TokenRequest{} },
+		NewWatcher: newTokenWatcher,
+	})
+}
 
-	logger.Debugf("Got an API request to add a ticker")
+// newTokenWatcher creates a token watcher from a validated request
+func newTokenWatcher(m *Manager, req Request) Watcher {
+	tokenReq := req.(*TokenRequest)
 
-	// read body
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		logger.Errorf("Error: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error reading body: %v", err)
-		return
-	}
+	token := NewToken(tokenReq.Network, tokenReq.Contract, tokenReq.Token, tokenReq.Name, tokenReq.Nickname, tokenReq.Frequency, tokenReq.format(), tokenReq.Activity, tokenReq.Color, tokenReq.Decorator, tokenReq.Source)
+	token.request = tokenReq
+	token.setTemplates(tokenReq.NicknameTemplate, tokenReq.ActivityTemplate)
 
-	// unmarshal into struct
-	var tokenReq TokenRequest
-	if err := json.Unmarshal(body, &tokenReq); err != nil {
-		logger.Errorf("Error unmarshalling: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error unmarshalling: %v", err)
-		return
-	}
+	return token
+}
 
-	// ensure token is set
-	if tokenReq.Token == "" {
-		logger.Error("Discord token required")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: token required")
-		return
-	}
+// validate fills in defaults and ensures the request can be used to start a token watcher
+func (tokenReq *TokenRequest) validate() error {
+	var v validator
+
+	v.require("discord_bot_token", tokenReq.Token)
+	v.template("nickname_template", tokenReq.NicknameTemplate)
+	v.template("activity_template", tokenReq.ActivityTemplate)
+	v.require("name", tokenReq.Name)
+	v.require("contract", tokenReq.Contract)
+	v.frequency(&tokenReq.Frequency)
+	v.format(tokenReq.format())
 
 	// ensure network is set, default to eth
 	if tokenReq.Network == "" {
 		tokenReq.Network = "ethereum"
 	}
+	v.oneOf("network", tokenReq.Network, networks)
 
-	// ensure freq is set
-	if tokenReq.Frequency == 0 {
-		tokenReq.Frequency = 60
-	}
-
-	// ensure name is set
-	if tokenReq.Name == "" {
-		logger.Error("Name required for token")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Name required")
-		return
-	}
-
-	// check if already existing
-	if _, ok := m.WatchingToken[strings.ToUpper(tokenReq.Contract)]; ok {
-		logger.Error("Error: ticker already exists")
-		w.WriteHeader(http.StatusConflict)
-		return
+	// ensure source is set, default to 1inch
+	if tokenReq.Source == "" {
+		tokenReq.Source = "1inch"
 	}
+	v.oneOf("source", tokenReq.Source, tokenSources)
+	v.check(tokenReq.Source != "pancakeswap" || tokenReq.Network == "binance-smart-chain", "source", "pancakeswap only supports binance-smart-chain")
 
-	token := NewToken(tokenReq.Network, tokenReq.Contract, tokenReq.Token, tokenReq.Name, tokenReq.Nickname, tokenReq.Frequency, tokenReq.Decimals, tokenReq.Activity, tokenReq.Color, tokenReq.Decorator, tokenReq.Source)
-	m.addToken(token)
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(token)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-	}
+	return v.err()
 }
 
-func (m *Manager) addToken(token *Token) {
-	tokenCount.Inc()
-	m.WatchingToken[fmt.Sprintf("%s-%s", token.Network, token.Contract)] = token
-}
-
-// DeleteToken addds a new token or crypto to the list of what to watch
-func (m *Manager) DeleteToken(w http.ResponseWriter, r *http.Request) {
-	m.Lock()
-	defer m.Unlock()
-
-	logger.Debugf("Got an API request to delete a ticker")
-
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	if _, ok := m.WatchingToken[id]; !ok {
-		logger.Error("Error: no ticker found")
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprint(w, "Error: ticker not found")
-		return
-	}
-	// send shutdown sign
-	m.WatchingToken[id].Shutdown()
-	tokenCount.Dec()
-
-	// remove from cache
-	delete(m.WatchingToken, id)
-
-	logger.Infof("Deleted ticker %s", id)
-	w.WriteHeader(http.StatusNoContent)
+// id is the key the token is watched under
+func (tokenReq TokenRequest) id() string {
+	return fmt.Sprintf("%s-%s", tokenReq.Network, tokenReq.Contract)
 }
 
-// GetToken returns a list of what the manager is watching
-func (m *Manager) GetToken(w http.ResponseWriter, r *http.Request) {
-	m.RLock()
-	defer m.RUnlock()
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(m.WatchingToken); err != nil {
-		logger.Errorf("Error serving request: %v", err)
-		fmt.Fprintf(w, "Error: %v", err)
+// format is how the token shows numbers
+func (tokenReq TokenRequest) format() utils.NumberFormat {
+	return utils.NumberFormat{
+		Decimals:    tokenReq.Decimals,
+		Significant: tokenReq.SignificantDigits,
+		Compact:     tokenReq.Compact,
+		Subscript:   tokenReq.SubscriptZeros,
+		Separators:  tokenReq.ThousandsSeparators,
+		Trim:        tokenReq.TrimZeros,
+		Locale:      tokenReq.Locale,
 	}
 }
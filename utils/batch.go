@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// batchIdleIntervals is how many intervals a symbol stays in the batch after it was last asked for
+	batchIdleIntervals = 5
+	// batchCachePrefix keeps batched quotes apart from the documents single lookups cache for the same symbol
+	batchCachePrefix = "quote#"
+)
+
+// Batcher refreshes every symbol watchers ask for with a few multi-symbol calls per interval,
+// instead of one call per watcher
+type Batcher struct {
+	// name is the provider the batcher fetches from, it keys the cache and labels errors
+	name      string
+	interval  time.Duration
+	batchSize int
+	// fetchMany gets quotes for up to batchSize symbols in one call
+	fetchMany func(ctx context.Context, symbols []string) (map[string]Quote, error)
+	// fetchOne gets the first quote for a symbol, filling in anything fetchMany does not return
+	fetchOne func(ctx context.Context, symbol string) (Quote, error)
+	symbols  map[string]*batchedSymbol
+	// cache shares batched quotes with other instances under the name of the provider, when set
+	cache Cache
+	ttl   time.Duration
+	sync.Mutex
+}
+
+// batchedSymbol is the latest quote for a symbol and when a watcher last asked for it
+type batchedSymbol struct {
+	quote   Quote
+	loaded  bool
+	fetched time.Time
+	asked   time.Time
+}
+
+// NewBatcher creates a batcher, call Run to start refreshing
+func NewBatcher(name string, interval time.Duration, batchSize int, fetchMany func(context.Context, []string) (map[string]Quote, error), fetchOne func(context.Context, string) (Quote, error)) *Batcher {
+	return &Batcher{
+		name:      name,
+		interval:  interval,
+		batchSize: batchSize,
+		fetchMany: fetchMany,
+		fetchOne:  fetchOne,
+		symbols:   make(map[string]*batchedSymbol),
+	}
+}
+
+// UseCache reads batched quotes from cache before fetching them, and writes what it fetches back for ttl
+func (b *Batcher) UseCache(cache Cache, ttl time.Duration) {
+	b.cache = cache
+	b.ttl = ttl
+}
+
+// Quote returns the latest batched quote for a symbol. Symbols seen for the first time, or whose
+// batched quote has gone stale, are fetched on their own.
+func (b *Batcher) Quote(ctx context.Context, symbol string) (Quote, error) {
+	b.Lock()
+	s, ok := b.symbols[symbol]
+	if !ok {
+		s = &batchedSymbol{}
+		b.symbols[symbol] = s
+	}
+	s.asked = time.Now()
+
+	if s.loaded && time.Since(s.fetched) < 2*b.interval {
+		quote := s.quote
+		b.Unlock()
+		return quote, nil
+	}
+	b.Unlock()
+
+	quote, err := b.fetchOne(ctx, symbol)
+	if err != nil {
+		return quote, err
+	}
+
+	b.Lock()
+	s.quote = quote
+	s.loaded = true
+	s.fetched = time.Now()
+	b.Unlock()
+
+	return quote, nil
+}
+
+// Run refreshes the batched symbols every interval, it never returns
+func (b *Batcher) Run() {
+	ticker := time.NewTicker(b.interval)
+	for range ticker.C {
+		b.refresh()
+	}
+}
+
+// refresh drops symbols nobody asks for anymore, takes what it can from the cache and fetches the rest in batches
+func (b *Batcher) refresh() {
+	b.Lock()
+	var symbols []string
+	for symbol, s := range b.symbols {
+		if time.Since(s.asked) > batchIdleIntervals*b.interval {
+			delete(b.symbols, symbol)
+			continue
+		}
+		if s.loaded {
+			symbols = append(symbols, symbol)
+		}
+	}
+	b.Unlock()
+
+	quotes := make(map[string]Quote, len(symbols))
+	missing := symbols
+	if b.cache != nil {
+		missing = nil
+		for _, symbol := range symbols {
+			var quote Quote
+			if cacheGet(b.cache, b.name, batchCachePrefix+symbol, &quote) {
+				quotes[symbol] = quote
+				continue
+			}
+			missing = append(missing, symbol)
+		}
+	}
+
+	for start := 0; start < len(missing); start += b.batchSize {
+		end := start + b.batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		fetched, err := b.fetchMany(context.Background(), missing[start:end])
+		if err != nil {
+			// watchers fall back to fetching on their own once the quotes go stale
+			Logger.Errorf("Unable to fetch a batch of %d %s quotes: %s", end-start, b.name, err)
+			if !counted(err) {
+				UpstreamErrors.WithLabelValues(b.name, ErrorType(err)).Inc()
+			}
+			continue
+		}
+
+		for symbol, quote := range fetched {
+			quotes[symbol] = quote
+			if b.cache != nil {
+				cacheSet(b.cache, b.ttl, b.name, batchCachePrefix+symbol, quote)
+			}
+		}
+	}
+
+	b.Lock()
+	for symbol, quote := range quotes {
+		s, ok := b.symbols[symbol]
+		if !ok {
+			continue
+		}
+
+		// keep what only the single fetch returns
+		if quote.Symbol == "" {
+			quote.Symbol = s.quote.Symbol
+		}
+		if quote.Name == "" {
+			quote.Name = s.quote.Name
+		}
+		s.quote = quote
+		s.fetched = time.Now()
+	}
+	b.Unlock()
+}
+
+// StartBatching refreshes watched coins and stocks together every interval instead of once per watcher.
+// It must be called before any quotes are fetched, and after EnableCache so batches and first lookups use the cache.
+func StartBatching(interval time.Duration) {
+	providersMu.RLock()
+	gecko, ok := providers["coingecko"].(*CoinGecko)
+	if !ok {
+		gecko = &CoinGecko{}
+	}
+	yahoo, ok := providers["yahoo"].(Yahoo)
+	if !ok {
+		yahoo = Yahoo{}
+	}
+	providersMu.RUnlock()
+
+	geckoBatch = NewBatcher(gecko.Name(), interval, geckoBatchSize, geckoSimpleQuotes, gecko.fetch)
+	if gecko.Cache != nil {
+		geckoBatch.UseCache(gecko.Cache, gecko.TTL)
+	}
+	go geckoBatch.Run()
+
+	yahooBatch = NewBatcher(yahoo.Name(), interval, yahooBatchSize, yahooBatchQuotes, yahoo.fetch)
+	if yahoo.Cache != nil {
+		yahooBatch.UseCache(yahoo.Cache, yahoo.TTL)
+	}
+	go yahooBatch.Run()
+}
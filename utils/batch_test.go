@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBatchErrorsCounted(t *testing.T) {
+	failing := func(context.Context, []string) (map[string]Quote, error) {
+		return nil, errors.New("no quotes in the response")
+	}
+	b := NewBatcher("test", time.Minute, 10, failing, nil)
+	b.symbols["ABC"] = &batchedSymbol{loaded: true, asked: time.Now()}
+
+	errs := UpstreamErrors.WithLabelValues("test", "other")
+	before := testutil.ToFloat64(errs)
+	b.refresh()
+	if got := testutil.ToFloat64(errs) - before; got != 1 {
+		t.Errorf("a failed batch counted %v upstream errors, want 1", got)
+	}
+
+	// errors from the client were counted when they happened
+	client := func(context.Context, []string) (map[string]Quote, error) {
+		return nil, &StatusError{URL: "https://example.com", StatusCode: 500, Status: "500 Internal Server Error"}
+	}
+	b.fetchMany = client
+	status := UpstreamErrors.WithLabelValues("test", "status")
+	before = testutil.ToFloat64(status)
+	b.refresh()
+	if got := testutil.ToFloat64(status) - before; got != 0 {
+		t.Errorf("a failed client call was counted again %v times", got)
+	}
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultCacheTTL is how long cached prices are used when a provider does not set its own TTL
+	DefaultCacheTTL = time.Minute
+
+	redisKeyFormat = "discord-stock-ticker#%s"
+)
+
+var (
+	// ErrCacheMiss is returned by a Cache that does not have a key
+	ErrCacheMiss = errors.New("cache miss")
+
+	// CacheRequests counts cache lookups by provider and result (hit, miss or error)
+	CacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_requests_total",
+			Help: "Number of price cache lookups by provider and result.",
+		},
+		[]string{"provider", "result"},
+	)
+)
+
+// Cache stores json documents for a limited time
+type Cache interface {
+	// Get returns the document stored under key, or ErrCacheMiss
+	Get(key string) ([]byte, error)
+	// Set stores a document under key until ttl passes
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// Cacheable is a provider that can keep its results in a Cache
+type Cacheable interface {
+	PriceProvider
+	// WithCache returns a copy of the provider that reads from and writes to cache
+	WithCache(cache Cache, ttl time.Duration) PriceProvider
+}
+
+// EnableCache swaps the named providers for copies that use cache
+func EnableCache(cache Cache, ttl time.Duration, names ...string) error {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		providersMu.RLock()
+		p, ok := providers[name]
+		providersMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("unknown price provider %s", name)
+		}
+
+		c, ok := p.(Cacheable)
+		if !ok {
+			return fmt.Errorf("price provider %s cannot be cached", name)
+		}
+		RegisterProvider(c.WithCache(cache, ttl))
+	}
+
+	return nil
+}
+
+// RedisCache keeps documents in redis, one json key per document
+type RedisCache struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+// NewRedisCache creates a cache on a redis server
+func NewRedisCache(client *redis.Client, ctx context.Context) *RedisCache {
+	return &RedisCache{
+		client: client,
+		ctx:    ctx,
+	}
+}
+
+// Get returns the document stored under key
+func (r *RedisCache) Get(key string) ([]byte, error) {
+	value, err := r.client.Get(r.ctx, fmt.Sprintf(redisKeyFormat, key)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+
+	return value, err
+}
+
+// Set stores a document that redis expires after ttl
+func (r *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(r.ctx, fmt.Sprintf(redisKeyFormat, key), value, ttl).Err()
+}
+
+// cached fills v from the cache, or calls fetch to fill it and writes the result back.
+// A broken cache never fails a lookup, it only costs a call to the source.
+func cached(cache Cache, ttl time.Duration, provider string, symbol string, v interface{}, fetch func() error) error {
+	if cache == nil {
+		return fetch()
+	}
+
+	if cacheGet(cache, provider, symbol, v) {
+		return nil
+	}
+
+	if err := fetch(); err != nil {
+		return err
+	}
+	cacheSet(cache, ttl, provider, symbol, v)
+
+	return nil
+}
+
+// cacheGet fills v from the cache, reporting if it was there
+func cacheGet(cache Cache, provider string, symbol string, v interface{}) bool {
+	raw, err := cache.Get(cacheKey(provider, symbol))
+	switch {
+	case err == nil && json.Unmarshal(raw, v) == nil:
+		CacheRequests.WithLabelValues(provider, "hit").Inc()
+		return true
+	case err == nil, err == ErrCacheMiss:
+		CacheRequests.WithLabelValues(provider, "miss").Inc()
+	default:
+		CacheRequests.WithLabelValues(provider, "error").Inc()
+	}
+
+	return false
+}
+
+// cacheSet writes v to the cache for ttl, or DefaultCacheTTL when ttl is not set
+func cacheSet(cache Cache, ttl time.Duration, provider string, symbol string, v interface{}) {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	raw, err := json.Marshal(v)
+	if err == nil {
+		err = cache.Set(cacheKey(provider, symbol), raw, ttl)
+	}
+	if err != nil {
+		CacheRequests.WithLabelValues(provider, "error").Inc()
+	}
+}
+
+// cacheKey is where a provider keeps a symbol in the cache
+func cacheKey(provider string, symbol string) string {
+	return fmt.Sprintf("%s#%s", provider, symbol)
+}
@@ -0,0 +1,360 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTimeout          = 10 * time.Second
+	defaultRetries          = 2
+	defaultRetryBackoff     = time.Second
+	defaultMaxRetryWait     = 30 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+var (
+	// UpstreamErrors counts failed calls to price sources by host and kind of error
+	UpstreamErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_errors_total",
+			Help: "Number of failed calls to price sources by host and error type.",
+		},
+		[]string{"host", "type"},
+	)
+
+	// DefaultClient is used for every call to a price source
+	DefaultClient = NewClient()
+
+	// Logger reports errors of background refreshes, which have no caller to return them to
+	Logger logrus.FieldLogger = logrus.StandardLogger()
+)
+
+// StatusError is returned when a source answers with anything but a 200
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.URL, e.Status)
+}
+
+// RequestError is returned when a source could not be reached
+type RequestError struct {
+	URL string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("requesting %s: %s", e.URL, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when a source sends something that is not the json we expect
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding %s: %s", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// CircuitOpenError is returned without calling a host that has failed too often recently
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is failing, not calling it until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// ErrorType names the kind of error a call failed with, for logs and metrics
+func ErrorType(err error) string {
+	var statusErr *StatusError
+	var requestErr *RequestError
+	var decodeErr *DecodeError
+	var circuitErr *CircuitOpenError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &circuitErr):
+		return "circuit_open"
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return "rate_limited"
+		}
+		return "status"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &requestErr):
+		return "network"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	}
+
+	return "other"
+}
+
+// Client wraps http.Client with retries and a circuit breaker per host
+type Client struct {
+	HTTP *http.Client
+	// Retries is how many times a failed call is tried again
+	Retries int
+	// RetryBackoff is the first wait between retries, it doubles every attempt
+	RetryBackoff time.Duration
+	// MaxRetryWait caps how long a Retry-After header can make us wait
+	MaxRetryWait time.Duration
+	// BreakerThreshold is how many failed calls in a row open the circuit for a host
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit stays open
+	BreakerCooldown time.Duration
+
+	breakers map[string]*breaker
+	sync.Mutex
+}
+
+// breaker tracks failed calls to a single host
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// NewClient creates a client with the default timeouts and limits
+func NewClient() *Client {
+	return &Client{
+		HTTP:             &http.Client{Timeout: defaultTimeout},
+		Retries:          defaultRetries,
+		RetryBackoff:     defaultRetryBackoff,
+		MaxRetryWait:     defaultMaxRetryWait,
+		BreakerThreshold: defaultBreakerThreshold,
+		BreakerCooldown:  defaultBreakerCooldown,
+		breakers:         make(map[string]*breaker),
+	}
+}
+
+// GetJSON fetches a url and decodes the json body into v
+func (c *Client) GetJSON(ctx context.Context, reqURL string, v interface{}) error {
+	body, err := c.Get(ctx, reqURL)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		err = &DecodeError{URL: reqURL, Err: err}
+		c.count(reqURL, err)
+		return err
+	}
+
+	return nil
+}
+
+// Get fetches a url, retrying network errors, rate limits and server errors.
+// Cancelling ctx stops the call, including any wait for the rate limit or a retry.
+func (c *Client) Get(ctx context.Context, reqURL string) ([]byte, error) {
+	host := hostOf(reqURL)
+
+	if err := c.allow(host); err != nil {
+		c.count(reqURL, err)
+		return nil, err
+	}
+
+	var body []byte
+	var err error
+	for attempt := 0; ; attempt++ {
+		var wait time.Duration
+		body, wait, err = c.get(ctx, reqURL)
+		if err == nil || attempt >= c.Retries || !retryable(err) || ctx.Err() != nil {
+			break
+		}
+		c.count(reqURL, err)
+
+		if wait == 0 {
+			wait = c.RetryBackoff << attempt
+			wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		}
+		if sleep(ctx, wait) != nil {
+			break
+		}
+	}
+
+	// a cancelled call says nothing about the health of the source
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	c.record(host, err)
+	if err != nil {
+		c.count(reqURL, err)
+	}
+
+	return body, err
+}
+
+// get makes a single attempt, returning how long the source asked us to wait before trying again
+func (c *Client) get(ctx context.Context, reqURL string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, 0, &RequestError{URL: reqURL, Err: err}
+	}
+	req.Header.Add("User-Agent", "Mozilla/5.0")
+	req.Header.Add("accept", "application/json")
+
+	if err := waitForHost(ctx, req.URL.Host); err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, 0, &RequestError{URL: reqURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.retryAfter(resp), &StatusError{URL: reqURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &RequestError{URL: reqURL, Err: err}
+	}
+
+	return body, 0, nil
+}
+
+// retryAfter reads the Retry-After header as seconds or a date, capped at MaxRetryWait
+func (c *Client) retryAfter(resp *http.Response) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = time.Until(date)
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	if wait > c.MaxRetryWait {
+		return c.MaxRetryWait
+	}
+
+	return wait
+}
+
+// allow returns an error while the circuit for a host is open
+func (c *Client) allow(host string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok || !time.Now().Before(b.openUntil) {
+		return nil
+	}
+
+	return &CircuitOpenError{Host: host, Until: b.openUntil}
+}
+
+// record opens the circuit for a host once it has failed BreakerThreshold calls in a row.
+// Only errors that say the host is unhealthy count, a 404 for a bad symbol does not.
+func (c *Client) record(host string, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = &breaker{}
+		c.breakers[host] = b
+	}
+
+	if err == nil || !retryable(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= c.BreakerThreshold {
+		b.openUntil = time.Now().Add(c.BreakerCooldown)
+		b.failures = 0
+	}
+}
+
+func (c *Client) count(reqURL string, err error) {
+	UpstreamErrors.WithLabelValues(hostOf(reqURL), ErrorType(err)).Inc()
+}
+
+// counted reports if err came from a client, which counts its errors as they happen
+func counted(err error) bool {
+	switch ErrorType(err) {
+	case "", "other":
+		return false
+	}
+	return true
+}
+
+// retryable reports if trying again could help
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var requestErr *RequestError
+	return errors.As(err, &requestErr)
+}
+
+// sleep waits for d, returning the error of ctx if it is cancelled first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func hostOf(reqURL string) string {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return reqURL
+	}
+
+	return u.Host
+}
@@ -2,30 +2,43 @@ package utils
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"math/rand"
-	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
 	"time"
-
-	"github.com/go-redis/redis/v8"
 )
 
 const (
-	GeckoURL = "https://api.coingecko.com/api/v3/coins/%s"
+	GeckoURL       = "https://api.coingecko.com/api/v3/coins/%s"
+	GeckoSimpleURL = "https://api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=%s&include_24hr_change=true&include_24hr_vol=true"
+
+	// geckoBatchSize is how many coins are asked for in one /simple/price call
+	geckoBatchSize = 100
+)
+
+var (
+	// geckoBatch refreshes every watched coin together when batching is on
+	geckoBatch *Batcher
+
+	// geckoNonFiat are the currencies coingecko prices coins in that are not money with cents: other coins, gold and silver
+	geckoNonFiat = map[string]bool{
+		"btc": true, "eth": true, "ltc": true, "bch": true, "bnb": true, "eos": true, "xrp": true,
+		"xlm": true, "link": true, "dot": true, "yfi": true, "bits": true, "sats": true, "xag": true, "xau": true,
+	}
 )
 
-type CurrentPrice struct {
-	USD float64 `json:"usd"`
-	BTC float64 `json:"btc"`
+// IsFiat reports if a currency coingecko prices coins in is money that comes in cents
+func IsFiat(currency string) bool {
+	return !geckoNonFiat[strings.ToLower(currency)]
 }
 
+// MarketData holds the prices of a coin, keyed by lower case currency (usd, eur, btc, ...)
 type MarketData struct {
-	CurrentPrice        CurrentPrice `json:"current_price"`
-	PriceChangePercent  float64      `json:"price_change_percentage_24h"`
-	PriceChangeCurrency CurrentPrice `json:"price_change_24h_in_currency"`
+	CurrentPrice               map[string]float64 `json:"current_price"`
+	PriceChangePercent         float64            `json:"price_change_percentage_24h"`
+	PriceChangeCurrency        map[string]float64 `json:"price_change_24h_in_currency"`
+	PriceChangePercentCurrency map[string]float64 `json:"price_change_percentage_24h_in_currency"`
+	TotalVolume                map[string]float64 `json:"total_volume"`
 }
 
 // The following is the API response gecko gives
@@ -37,168 +50,146 @@ type GeckoPriceResults struct {
 }
 
 // GetCryptoPrice retrieves the price of a given ticker using the coin gecko API
-func GetCryptoPrice(ticker string) (GeckoPriceResults, error) {
+func GetCryptoPrice(ctx context.Context, ticker string) (GeckoPriceResults, error) {
 	var price GeckoPriceResults
 
 	reqURL := fmt.Sprintf(GeckoURL, ticker)
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return price, err
-	}
+	err := DefaultClient.GetJSON(ctx, reqURL, &price)
 
-	req.Header.Add("User-Agent", "Mozilla/5.0")
-	req.Header.Add("accept", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return price, err
-	}
+	return price, err
+}
 
-	if resp.StatusCode == 429 {
-		fmt.Println("Being rate limited by coingecko")
-
-		rand.Seed(time.Now().UnixNano())
-		n := rand.Intn(10)
-		time.Sleep(time.Duration(n) * time.Second)
-		secondAttempt, err := GetCryptoPrice(ticker)
-		if err != nil {
-			return price, err
-		} else {
-			return secondAttempt, nil
-		}
-	}
+// GetCryptoPriceCache uses the cache before calling coingecko, storing what it fetches for ttl
+func GetCryptoPriceCache(ctx context.Context, cache Cache, ttl time.Duration, ticker string) (GeckoPriceResults, error) {
+	var price GeckoPriceResults
 
-	results, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return price, err
-	}
-	err = json.Unmarshal(results, &price)
-	if err != nil {
-		fmt.Printf(resp.Status)
-		return price, err
-	}
+	err := cached(cache, ttl, "coingecko", ticker, &price, func() (err error) {
+		price, err = GetCryptoPrice(ctx, ticker)
+		return err
+	})
 
-	return price, nil
+	return price, err
 }
 
-// GetCryptoPriceCache attempt to use cache to get info
-func GetCryptoPriceCache(client *redis.Client, ctx context.Context, ticker string) (GeckoPriceResults, error) {
-	var currentPrice CurrentPrice
-	var marketData MarketData
-	var geckoPriceResults GeckoPriceResults
-	var symbol string
-	var name string
-
-	// get CurrentPrice
-	var priceFloat float64
-	price, err := client.Get(ctx, fmt.Sprintf("%s#CurrentPrice", ticker)).Result()
-	if err == redis.Nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		fmt.Println("cache miss")
-		return geckoPriceResults, err
-	} else if err != nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		return geckoPriceResults, err
-	} else {
-		priceFloat, err = strconv.ParseFloat(price, 32)
-		if err != nil {
-			geckoPriceResults, err = GetCryptoPrice(ticker)
-			return geckoPriceResults, err
-		}
-	}
+// GetSimplePrices retrieves the price and 24 hour change of many coins in one call.
+// Results are keyed by coin id, then by currency (usd), change (usd_24h_change) and volume (usd_24h_vol)
+// for each of the currencies.
+func GetSimplePrices(ctx context.Context, ids []string, currencies []string) (map[string]map[string]float64, error) {
+	var prices map[string]map[string]float64
 
-	// get current btc price
-	var btcFloat float64
-	btc, err := client.Get(ctx, "bitcoin#CurrentPrice").Result()
-	if err == redis.Nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		fmt.Println("cache miss on btc")
-		return geckoPriceResults, err
-	} else if err != nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		return geckoPriceResults, err
-	} else {
-		btcFloat, err = strconv.ParseFloat(btc, 32)
-		if err != nil {
-			geckoPriceResults, err = GetCryptoPrice(ticker)
-			return geckoPriceResults, err
+	reqURL := fmt.Sprintf(GeckoSimpleURL, url.QueryEscape(strings.Join(ids, ",")), url.QueryEscape(strings.Join(currencies, ",")))
+	err := DefaultClient.GetJSON(ctx, reqURL, &prices)
+
+	return prices, err
+}
+
+// geckoSimpleQuotes fetches coins with one /simple/price call, in every currency the symbols ask for
+func geckoSimpleQuotes(ctx context.Context, symbols []string) (map[string]Quote, error) {
+	var ids, currencies []string
+	seenIDs := make(map[string]bool)
+	seenCurrencies := make(map[string]bool)
+	for _, symbol := range symbols {
+		id, currency := splitCoinSymbol(symbol)
+		if !seenIDs[id] {
+			seenIDs[id] = true
+			ids = append(ids, id)
+		}
+		if !seenCurrencies[currency] {
+			seenCurrencies[currency] = true
+			currencies = append(currencies, currency)
 		}
 	}
 
-	currentPrice = CurrentPrice{priceFloat, priceFloat / btcFloat}
-
-	// price change
-	var priceChangeFloat float64
-	priceChange, err := client.Get(ctx, fmt.Sprintf("%s#PriceChange24H", ticker)).Result()
-	if err == redis.Nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		fmt.Println("cache miss")
-		return geckoPriceResults, err
-	} else if err != nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		return geckoPriceResults, err
-	} else {
-		priceChangeFloat, err = strconv.ParseFloat(priceChange, 32)
-		if err != nil {
-			geckoPriceResults, err = GetCryptoPrice(ticker)
-			return geckoPriceResults, err
-		}
+	prices, err := GetSimplePrices(ctx, ids, currencies)
+	if err != nil {
+		return nil, err
 	}
 
-	priceChangeCurrency := CurrentPrice{priceChangeFloat, priceChangeFloat / btcFloat}
-
-	// price change percent
-	var priceChangePercentFloat float64
-	priceChangePercent, err := client.Get(ctx, fmt.Sprintf("%s#PriceChangePercentage24H", ticker)).Result()
-	if err == redis.Nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		fmt.Println("cache miss")
-		return geckoPriceResults, err
-	} else if err != nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		return geckoPriceResults, err
-	} else {
-		priceChangePercentFloat, err = strconv.ParseFloat(priceChangePercent, 32)
-		if err != nil {
-			priceChangePercentFloat = 0.00
+	quotes := make(map[string]Quote, len(symbols))
+	for _, symbol := range symbols {
+		id, currency := splitCoinSymbol(symbol)
+		price, ok := prices[id][currency]
+		if !ok {
+			continue
+		}
+		percent := prices[id][currency+"_24h_change"]
+
+		quotes[symbol] = Quote{
+			Price:         price,
+			Change:        price - price/(1+percent/100),
+			ChangePercent: percent,
+			Currency:      strings.ToUpper(currency),
+			Timestamp:     time.Now(),
+			Source:        "coingecko",
+			Volume:        prices[id][currency+"_24h_vol"],
 		}
 	}
 
-	marketData = MarketData{
-		currentPrice,
-		priceChangePercentFloat,
-		priceChangeCurrency,
+	return quotes, nil
+}
+
+// CoinGecko provides crypto quotes from coingecko, symbols are coin ids like bitcoin.
+// When Cache is set prices are read from it before going to the api.
+type CoinGecko struct {
+	Cache Cache
+	TTL   time.Duration
+}
+
+// Name is the name requests use for coingecko
+func (*CoinGecko) Name() string {
+	return "coingecko"
+}
+
+// WithCache returns a coingecko provider that uses cache
+func (*CoinGecko) WithCache(cache Cache, ttl time.Duration) PriceProvider {
+	return &CoinGecko{Cache: cache, TTL: ttl}
+}
+
+// GetQuote fetches a crypto price, from the batch when batching is on. Symbols are a coin id for
+// USD prices, or built with CoinSymbol for any other currency coingecko has.
+func (c *CoinGecko) GetQuote(ctx context.Context, symbol string) (Quote, error) {
+	if geckoBatch != nil {
+		return geckoBatch.Quote(ctx, symbol)
 	}
 
-	// symbol
-	symbol, err = client.Get(ctx, fmt.Sprintf("%s#Symbol", ticker)).Result()
-	if err == redis.Nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		fmt.Println("cache miss")
-		return geckoPriceResults, err
-	} else if err != nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		return geckoPriceResults, err
+	return c.fetch(ctx, symbol)
+}
+
+// fetch gets a single coin from the coins endpoint, which has every currency at once
+func (c *CoinGecko) fetch(ctx context.Context, symbol string) (Quote, error) {
+	var priceData GeckoPriceResults
+	var err error
+
+	id, currency := splitCoinSymbol(symbol)
+	if c.Cache == nil {
+		priceData, err = GetCryptoPrice(ctx, id)
+	} else {
+		priceData, err = GetCryptoPriceCache(ctx, c.Cache, c.TTL, id)
+	}
+	if err != nil {
+		return Quote{}, err
 	}
 
-	// name
-	name, err = client.Get(ctx, fmt.Sprintf("%s#Name", ticker)).Result()
-	if err == redis.Nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		fmt.Println("cache miss")
-		return geckoPriceResults, err
-	} else if err != nil {
-		geckoPriceResults, err = GetCryptoPrice(ticker)
-		return geckoPriceResults, err
+	market := priceData.MarketData
+	price, ok := market.CurrentPrice[currency]
+	if !ok {
+		return Quote{}, fmt.Errorf("coingecko has no %s price for %s", currency, id)
 	}
 
-	geckoPriceResults = GeckoPriceResults{
-		ticker,
-		symbol,
-		name,
-		marketData,
+	percent, ok := market.PriceChangePercentCurrency[currency]
+	if !ok && currency == "usd" {
+		percent = market.PriceChangePercent
 	}
 
-	fmt.Println("cache hit")
-	return geckoPriceResults, nil
+	return Quote{
+		Symbol:        strings.ToUpper(priceData.Symbol),
+		Name:          priceData.Name,
+		Price:         price,
+		Change:        market.PriceChangeCurrency[currency],
+		ChangePercent: percent,
+		Currency:      strings.ToUpper(currency),
+		Timestamp:     time.Now(),
+		Source:        c.Name(),
+		Volume:        market.TotalVolume[currency],
+	}, nil
 }
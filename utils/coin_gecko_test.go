@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestIsFiat(t *testing.T) {
+	tests := map[string]bool{
+		"usd":  true,
+		"EUR":  true,
+		"gbp":  true,
+		"btc":  false,
+		"ETH":  false,
+		"sats": false,
+		"xau":  false,
+	}
+
+	for currency, want := range tests {
+		if got := IsFiat(currency); got != want {
+			t.Errorf("IsFiat(%q) = %v, want %v", currency, got, want)
+		}
+	}
+}
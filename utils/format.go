@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// subscriptZeros is how many zeros after the decimal point it takes before they are written as a subscript
+	subscriptZeros = 3
+	// subscriptDigits is how many digits follow the subscript when Significant is not set
+	subscriptDigits = 4
+)
+
+// compactSuffixes shorten numbers of a thousand and up, one per power of a thousand
+var compactSuffixes = []string{"", "K", "M", "B", "T"}
+
+// NumberFormat describes how a bot shows prices and changes
+type NumberFormat struct {
+	// Decimals fixes the digits after the decimal point
+	Decimals int `json:"decimals"`
+	// Significant shows this many significant digits instead of fixed decimals
+	Significant int `json:"significant_digits"`
+	// Compact shortens large numbers with K, M, B and T suffixes, 1.2K
+	Compact bool `json:"compact"`
+	// Subscript writes the zeros of tiny numbers as a count, 0.0₅123
+	Subscript bool `json:"subscript_zeros"`
+	// Separators groups the whole part of a number in thousands, 1,234,567
+	Separators bool `json:"thousands_separators"`
+	// Trim drops trailing zeros after the decimal point
+	Trim bool `json:"trim_zeros"`
+	// Locale picks the separators, symbol placement and percent style, see Locales
+	Locale string `json:"locale"`
+}
+
+// Default reports if neither decimals nor significant digits are set, leaving the precision up to the bot
+func (f NumberFormat) Default() bool {
+	return f.Decimals == 0 && f.Significant == 0
+}
+
+// WithDecimals returns a copy that uses decimals when the format does not set a precision of its own
+func (f NumberFormat) WithDecimals(decimals int) NumberFormat {
+	if f.Default() {
+		f.Decimals = decimals
+	}
+	return f
+}
+
+// Fixed returns a format that only keeps the locale, with fixed decimals
+func (f NumberFormat) Fixed(decimals int) NumberFormat {
+	return NumberFormat{Decimals: decimals, Locale: f.Locale}
+}
+
+// Money puts a currency symbol on a formatted price, where the locale wants it
+func (f NumberFormat) Money(number string, symbol string) string {
+	if symbol == "" {
+		return number
+	}
+
+	l := f.locale()
+	space := ""
+	if l.SymbolSpace {
+		space = " "
+	}
+	if l.SymbolAfter {
+		return number + space + symbol
+	}
+
+	// the sign goes in front of the symbol, -$1.23
+	if strings.HasPrefix(number, "-") {
+		return "-" + symbol + space + number[1:]
+	}
+	return symbol + space + number
+}
+
+// Percent puts a percent sign on a formatted percent, in the style of the locale
+func (f NumberFormat) Percent(number string) string {
+	if f.locale().PercentSpace {
+		return number + " %"
+	}
+	return number + "%"
+}
+
+// Format writes a number the way the format describes
+func (f NumberFormat) Format(value float64) string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	var sign string
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	var suffix string
+	if f.Compact {
+		value, suffix = f.compact(value)
+	}
+
+	if f.Subscript && value > 0 && value < math.Pow10(-subscriptZeros) {
+		if s, ok := f.subscript(value); ok {
+			return sign + f.separate(s) + suffix
+		}
+	}
+
+	s := strconv.FormatFloat(value, 'f', f.decimals(value), 64)
+	if f.Trim {
+		s = trimZeros(s)
+	}
+
+	// a number that rounds to zero has no sign
+	if strings.Trim(s, "0.") == "" {
+		sign = ""
+	}
+
+	return sign + f.separate(s) + suffix
+}
+
+// decimals is how many digits to show after the decimal point
+func (f NumberFormat) decimals(value float64) int {
+	if f.Significant == 0 {
+		return f.Decimals
+	}
+	if value == 0 {
+		return f.Significant - 1
+	}
+
+	whole := int(math.Floor(math.Log10(value))) + 1
+	if whole < f.Significant && roundTo(value, f.Significant-whole) >= math.Pow10(whole) {
+		// rounding carries into another whole digit, 9.999 to three digits is 10.0
+		whole++
+	}
+	if whole >= f.Significant {
+		return 0
+	}
+	return f.Significant - whole
+}
+
+// subscript writes a number below 0.001 as 0.0₅123, it is not ok if rounding leaves too few zeros to bother
+func (f NumberFormat) subscript(value float64) (string, bool) {
+	digits := f.Significant
+	if digits == 0 {
+		digits = subscriptDigits
+	}
+
+	zeros := -int(math.Floor(math.Log10(value))) - 1
+	s := strconv.FormatFloat(value, 'f', zeros+digits, 64)
+
+	// rounding can carry into the zeros, so count them again
+	fraction := strings.TrimPrefix(s, "0.")
+	if fraction == s {
+		return "", false
+	}
+	significant := strings.TrimLeft(fraction, "0")
+	zeros = len(fraction) - len(significant)
+	if zeros < subscriptZeros {
+		return "", false
+	}
+
+	if f.Trim {
+		significant = strings.TrimRight(significant, "0")
+	}
+
+	return "0.0" + subscriptNumber(zeros) + significant, true
+}
+
+// compact divides a number down to below a thousand, returning the suffix it now needs.
+// A number that only reaches a thousand once rounded moves on too, so 999,999 is 1.00M rather than 1000.00K.
+func (f NumberFormat) compact(value float64) (float64, string) {
+	i := 0
+	for i < len(compactSuffixes)-1 && f.rounded(value) >= 1000 {
+		value /= 1000
+		i++
+	}
+	return value, compactSuffixes[i]
+}
+
+// rounded is the value as the format would write it
+func (f NumberFormat) rounded(value float64) float64 {
+	return roundTo(value, f.decimals(value))
+}
+
+// roundTo rounds a value to decimals digits after the decimal point the way strconv writes it
+func roundTo(value float64, decimals int) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'f', decimals, 64), 64)
+	return rounded
+}
+
+// subscriptNumber writes n with subscript digits
+func subscriptNumber(n int) string {
+	var b strings.Builder
+	for _, d := range strconv.Itoa(n) {
+		b.WriteRune('₀' + d - '0')
+	}
+	return b.String()
+}
+
+// trimZeros drops trailing zeros after the decimal point, and the point if nothing is left after it
+func trimZeros(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// separate swaps the decimal point of a formatted number for the one of the locale,
+// grouping the whole part in thousands when separators are on or a locale is set
+func (f NumberFormat) separate(s string) string {
+	l := f.locale()
+
+	whole, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, fraction = s[:i], l.Decimal+s[i+1:]
+	}
+	if !f.Separators && f.Locale == "" {
+		return whole + fraction
+	}
+
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(d)
+	}
+
+	return b.String() + fraction
+}
+
+// locale is the locale the format names, or the default one
+func (f NumberFormat) locale() Locale {
+	if l, ok := locales[f.Locale]; ok {
+		return l
+	}
+	return defaultLocale
+}
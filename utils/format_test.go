@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format NumberFormat
+		value  float64
+		want   string
+	}{
+		{"decimals", NumberFormat{Decimals: 2}, 1234.5678, "1234.57"},
+		{"no decimals", NumberFormat{}, 1234.5678, "1235"},
+		{"negative", NumberFormat{Decimals: 2}, -1.234, "-1.23"},
+		{"negative rounds to zero", NumberFormat{Decimals: 2}, -0.001, "0.00"},
+		{"rounds up a digit", NumberFormat{Decimals: 2}, 9.999, "10.00"},
+		{"half rounds to even float", NumberFormat{Decimals: 1}, 0.25, "0.2"},
+
+		{"significant large", NumberFormat{Significant: 3}, 12345.678, "12346"},
+		{"significant whole", NumberFormat{Significant: 3}, 123.456, "123"},
+		{"significant fraction", NumberFormat{Significant: 3}, 1.23456, "1.23"},
+		{"significant small", NumberFormat{Significant: 3}, 0.00123456, "0.00123"},
+		{"significant zero", NumberFormat{Significant: 3}, 0, "0.00"},
+		{"significant negative", NumberFormat{Significant: 2}, -0.0456, "-0.046"},
+		{"significant carries rounding", NumberFormat{Significant: 3}, 9.999, "10.0"},
+		{"significant carries rounding below one", NumberFormat{Significant: 3}, 0.99999, "1.00"},
+
+		{"compact below a thousand", NumberFormat{Decimals: 2, Compact: true}, 999.99, "999.99"},
+		{"compact thousands", NumberFormat{Decimals: 1, Compact: true}, 1234, "1.2K"},
+		{"compact millions", NumberFormat{Decimals: 2, Compact: true}, 1234567, "1.23M"},
+		{"compact trillions", NumberFormat{Decimals: 1, Compact: true}, 1.5e12, "1.5T"},
+		{"compact past trillions", NumberFormat{Decimals: 0, Compact: true}, 2.5e15, "2500T"},
+		{"compact negative", NumberFormat{Decimals: 1, Compact: true}, -45600, "-45.6K"},
+		{"compact carries rounding", NumberFormat{Decimals: 2, Compact: true}, 999999, "1.00M"},
+		{"compact carries rounding into K", NumberFormat{Decimals: 2, Compact: true}, 999.999, "1.00K"},
+		{"compact carries significant digits", NumberFormat{Significant: 3, Compact: true}, 999999, "1.00M"},
+		{"compact keeps what does not round up", NumberFormat{Decimals: 2, Compact: true}, 999994, "999.99K"},
+
+		{"subscript", NumberFormat{Subscript: true}, 0.00001234567, "0.0₄1235"},
+		{"subscript significant", NumberFormat{Subscript: true, Significant: 2}, 0.000000123, "0.0₆12"},
+		{"subscript negative", NumberFormat{Subscript: true}, -0.00001234567, "-0.0₄1235"},
+		{"subscript needs enough zeros", NumberFormat{Subscript: true, Decimals: 4}, 0.0012, "0.0012"},
+
+		{"trim", NumberFormat{Decimals: 4, Trim: true}, 1.5, "1.5"},
+		{"trim whole", NumberFormat{Decimals: 4, Trim: true}, 2, "2"},
+		{"separators", NumberFormat{Decimals: 2, Separators: true}, 1234567.891, "1,234,567.89"},
+		{"separators negative", NumberFormat{Separators: true}, -1234567, "-1,234,567"},
+		{"separators short", NumberFormat{Separators: true}, 123, "123"},
+
+		{"not a number", NumberFormat{Decimals: 2}, math.NaN(), "NaN"},
+		{"infinity", NumberFormat{Decimals: 2}, math.Inf(-1), "-Inf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.Format(tt.value); got != tt.want {
+				t.Errorf("%+v.Format(%v) = %q, want %q", tt.format, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithDecimals(t *testing.T) {
+	if got := (NumberFormat{}).WithDecimals(3).Decimals; got != 3 {
+		t.Errorf("default format got %d decimals, want 3", got)
+	}
+	if got := (NumberFormat{Decimals: 1}).WithDecimals(3).Decimals; got != 1 {
+		t.Errorf("format with decimals got %d decimals, want 1", got)
+	}
+	if got := (NumberFormat{Significant: 4}).WithDecimals(3); got.Decimals != 0 || got.Significant != 4 {
+		t.Errorf("format with significant digits got %+v, want it unchanged", got)
+	}
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFXInterval is how often exchange rates are refreshed when StartFXRates is not called
+	DefaultFXInterval = 5 * time.Minute
+
+	// fxStaleIntervals is how many intervals a rate can go without a refresh before it is stale
+	fxStaleIntervals = 3
+	// fxIdleIntervals is how many intervals a rate is kept refreshed after it was last asked for
+	fxIdleIntervals = 5
+)
+
+// DefaultFXRates is the exchange rate service shared by every watcher
+var DefaultFXRates = NewFXRates(DefaultFXInterval)
+
+// FXRates keeps the exchange rates watchers ask for fresh, one yahoo lookup per currency pair
+// no matter how many watchers use it
+type FXRates struct {
+	interval time.Duration
+	rates    map[string]*fxRate
+	sync.Mutex
+}
+
+// fxRate is the latest rate of a currency pair, when it was fetched and when a watcher last asked for it
+type fxRate struct {
+	rate    float64
+	fetched time.Time
+	asked   time.Time
+}
+
+// NewFXRates creates a rate service, call Run to refresh rates in the background
+func NewFXRates(interval time.Duration) *FXRates {
+	return &FXRates{
+		interval: interval,
+		rates:    make(map[string]*fxRate),
+	}
+}
+
+// Rate returns what one unit of from is worth in to, and if the rate is stale because refreshing it
+// keeps failing. An empty currency is taken to be USD.
+func (f *FXRates) Rate(ctx context.Context, from string, to string) (float64, bool, error) {
+	pair := fxPair(from, to)
+	if pair == "" {
+		return 1, false, nil
+	}
+
+	f.Lock()
+	r, ok := f.rates[pair]
+	if !ok {
+		r = &fxRate{}
+		f.rates[pair] = r
+	}
+	r.asked = time.Now()
+	rate, fetched := r.rate, r.fetched
+	f.Unlock()
+
+	// rates seen for the first time, or that the background refresh has not kept up with, are fetched now
+	if time.Since(fetched) > f.interval {
+		if err := f.refresh(ctx, pair); err != nil && rate == 0 {
+			return 0, false, err
+		}
+
+		f.Lock()
+		rate, fetched = r.rate, r.fetched
+		f.Unlock()
+	}
+
+	return rate, time.Since(fetched) > fxStaleIntervals*f.interval, nil
+}
+
+// Run refreshes the rates watchers use every interval, it never returns
+func (f *FXRates) Run() {
+	ticker := time.NewTicker(f.interval)
+	for range ticker.C {
+		f.Lock()
+		var pairs []string
+		for pair, r := range f.rates {
+			if time.Since(r.asked) > fxIdleIntervals*f.interval {
+				delete(f.rates, pair)
+				continue
+			}
+			pairs = append(pairs, pair)
+		}
+		f.Unlock()
+
+		// a failed refresh leaves the last rate, which watchers show as stale once it is too old
+		for _, pair := range pairs {
+			f.refresh(context.Background(), pair)
+		}
+	}
+}
+
+// refresh fetches the rate of a pair from yahoo
+func (f *FXRates) refresh(ctx context.Context, pair string) error {
+	yahoo, err := GetProvider("yahoo")
+	if err != nil {
+		return err
+	}
+
+	quote, err := yahoo.GetQuote(ctx, pair+"=X")
+	if err != nil {
+		return err
+	}
+	if quote.Price <= 0 {
+		return fmt.Errorf("yahoo returned no exchange rate for %s", pair)
+	}
+
+	f.Lock()
+	if r, ok := f.rates[pair]; ok {
+		r.rate = quote.Price
+		r.fetched = time.Now()
+	}
+	f.Unlock()
+
+	return nil
+}
+
+// fxPair is the yahoo name of a currency pair without the =X, GBP for USD to GBP and EURGBP otherwise.
+// It is empty when there is nothing to convert.
+func fxPair(from string, to string) string {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == "" {
+		from = "USD"
+	}
+	if to == "" || from == to {
+		return ""
+	}
+	if from == "USD" {
+		return to
+	}
+
+	return from + to
+}
+
+// StartFXRates refreshes exchange rates every interval in the background instead of only when a watcher asks
+func StartFXRates(interval time.Duration) {
+	DefaultFXRates = NewFXRates(interval)
+	go DefaultFXRates.Run()
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestFXPair(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"USD", "", ""},
+		{"GBP", "", ""},
+		{"USD", "USD", ""},
+		{"gbp", "GBP", ""},
+		{"", "EUR", "EUR"},
+		{"USD", "eur", "EUR"},
+		{"GBP", "USD", "GBPUSD"},
+		{"EUR", "GBP", "EURGBP"},
+	}
+
+	for _, tt := range tests {
+		if got := fxPair(tt.from, tt.to); got != tt.want {
+			t.Errorf("fxPair(%q, %q) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
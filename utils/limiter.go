@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// RateLimitWait tracks how long calls queue for their source's rate limit
+	RateLimitWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rate_limit_wait_seconds",
+			Help:    "Time calls to a price source spent waiting for its rate limit.",
+			Buckets: []float64{0, 0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+		},
+		[]string{"provider"},
+	)
+
+	// sourceHosts maps the hosts we call to the source they belong to
+	sourceHosts = map[string]string{
+		"api.coingecko.com":        "coingecko",
+		"query1.finance.yahoo.com": "yahoo",
+		"api.1inch.exchange":       "1inch",
+		"api.pancakeswap.info":     "pancakeswap",
+		"api.zapper.fi":            "zapper",
+	}
+
+	// DefaultRateLimits are the calls per minute each source allows
+	DefaultRateLimits = map[string]int{
+		"coingecko":   50,
+		"yahoo":       120,
+		"1inch":       60,
+		"pancakeswap": 60,
+		"zapper":      60,
+	}
+
+	limiters   = make(map[string]*Limiter)
+	limitersMu sync.RWMutex
+)
+
+func init() {
+	for name, perMinute := range DefaultRateLimits {
+		SetRateLimit(name, perMinute)
+	}
+}
+
+// Limiter is a token bucket, calls beyond the burst queue up and are let through at a steady rate
+type Limiter struct {
+	interval time.Duration
+	burst    int
+	// next is when the next call can go out if the bucket is empty
+	next time.Time
+	sync.Mutex
+}
+
+// NewLimiter allows perMinute calls a minute, with up to a tenth of that at once
+func NewLimiter(perMinute int) *Limiter {
+	burst := perMinute / 10
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    burst,
+	}
+}
+
+// Wait blocks until the caller may make a call, returning how long it waited.
+// If ctx is cancelled first the slot is given back and the error of ctx returned.
+func (l *Limiter) Wait(ctx context.Context) (time.Duration, error) {
+	l.Lock()
+	now := time.Now()
+
+	// a full bucket lets burst calls through straight away
+	if earliest := now.Add(-time.Duration(l.burst-1) * l.interval); l.next.Before(earliest) {
+		l.next = earliest
+	}
+
+	wait := l.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	l.next = l.next.Add(l.interval)
+	reserved := l.next
+	l.Unlock()
+
+	if err := sleep(ctx, wait); err != nil {
+		// give the slot back only if nobody reserved one after it, moving theirs would let calls through too fast
+		l.Lock()
+		if l.next.Equal(reserved) {
+			l.next = l.next.Add(-l.interval)
+		}
+		l.Unlock()
+		return wait, err
+	}
+	return wait, nil
+}
+
+// SetRateLimit sets how many calls a minute a source allows, zero or less removes the limit.
+// Sources are the ones in DefaultRateLimits.
+func SetRateLimit(name string, perMinute int) error {
+	if _, ok := DefaultRateLimits[name]; !ok {
+		sources := make([]string, 0, len(DefaultRateLimits))
+		for source := range DefaultRateLimits {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		return fmt.Errorf("unknown price source %s, expected one of: %s", name, strings.Join(sources, ", "))
+	}
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	if perMinute <= 0 {
+		delete(limiters, name)
+		return nil
+	}
+	limiters[name] = NewLimiter(perMinute)
+
+	return nil
+}
+
+// waitForHost queues a call to a host behind its source's rate limit
+func waitForHost(ctx context.Context, host string) error {
+	name, ok := sourceHosts[host]
+	if !ok {
+		return nil
+	}
+
+	limitersMu.RLock()
+	l, ok := limiters[name]
+	limitersMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	wait, err := l.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	RateLimitWait.WithLabelValues(name).Observe(wait.Seconds())
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// reserved waits for a goroutine calling Wait to take the slot after last, returning the new next slot
+func reserved(l *Limiter, last time.Time) time.Time {
+	for {
+		l.Lock()
+		next := l.next
+		l.Unlock()
+		if next.After(last) {
+			return next
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	// one call every 12 seconds, without a burst
+	l := NewLimiter(5)
+	if _, err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := l.next
+
+	// the last reservation is given back
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Wait(ctx); err == nil {
+		t.Fatalf("Wait() with a cancelled context did not fail")
+	}
+	if !l.next.Equal(first) {
+		t.Errorf("cancelled wait left the next slot at %s, want %s", l.next, first)
+	}
+
+	// a reservation others have reserved after is kept
+	ctx, cancel = context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := l.Wait(ctx)
+		cancelled <- err
+	}()
+	second := reserved(l, first)
+
+	later, stop := context.WithCancel(context.Background())
+	defer stop()
+	go l.Wait(later)
+	third := reserved(l, second)
+
+	cancel()
+	if err := <-cancelled; err == nil {
+		t.Fatalf("Wait() with a cancelled context did not fail")
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if !l.next.Equal(third) {
+		t.Errorf("cancelled wait moved the next slot from %s to %s with a later caller waiting", third, l.next)
+	}
+}
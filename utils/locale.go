@@ -0,0 +1,54 @@
+package utils
+
+import "sort"
+
+// Locale is how a region writes numbers, prices and percents
+type Locale struct {
+	// Decimal separates the whole part of a number from the fraction
+	Decimal string
+	// Group separates the thousands of the whole part
+	Group string
+	// SymbolAfter puts the currency symbol after the price, 1.234,56 €
+	SymbolAfter bool
+	// SymbolSpace puts a space between the currency symbol and the price
+	SymbolSpace bool
+	// PercentSpace puts a space before the percent sign, 12,5 %
+	PercentSpace bool
+}
+
+// defaultLocale is used when a bot does not set one, it matches how prices were always shown
+var defaultLocale = Locale{Decimal: ".", Group: ","}
+
+// locales are the locales bots can use, keyed by language tag
+var locales = map[string]Locale{
+	"en-US": {Decimal: ".", Group: ","},
+	"en-GB": {Decimal: ".", Group: ","},
+	"en-AU": {Decimal: ".", Group: ","},
+	"en-CA": {Decimal: ".", Group: ","},
+	"ja-JP": {Decimal: ".", Group: ","},
+	"de-DE": {Decimal: ",", Group: ".", SymbolAfter: true, SymbolSpace: true, PercentSpace: true},
+	"de-AT": {Decimal: ",", Group: ".", SymbolSpace: true, PercentSpace: true},
+	"de-CH": {Decimal: ".", Group: "’", SymbolSpace: true},
+	"fr-FR": {Decimal: ",", Group: " ", SymbolAfter: true, SymbolSpace: true, PercentSpace: true},
+	"fr-CA": {Decimal: ",", Group: " ", SymbolAfter: true, SymbolSpace: true, PercentSpace: true},
+	"es-ES": {Decimal: ",", Group: ".", SymbolAfter: true, SymbolSpace: true, PercentSpace: true},
+	"it-IT": {Decimal: ",", Group: ".", SymbolAfter: true, SymbolSpace: true},
+	"nl-NL": {Decimal: ",", Group: ".", SymbolSpace: true},
+	"pt-BR": {Decimal: ",", Group: ".", SymbolSpace: true},
+	"pt-PT": {Decimal: ",", Group: " ", SymbolAfter: true, SymbolSpace: true},
+	"pl-PL": {Decimal: ",", Group: " ", SymbolAfter: true, SymbolSpace: true},
+	"sv-SE": {Decimal: ",", Group: " ", SymbolAfter: true, SymbolSpace: true, PercentSpace: true},
+	"ru-RU": {Decimal: ",", Group: " ", SymbolAfter: true, SymbolSpace: true, PercentSpace: true},
+	"tr-TR": {Decimal: ",", Group: "."},
+}
+
+// Locales lists the locale names bots can use
+func Locales() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,81 @@
+package utils
+
+import "testing"
+
+func TestLocales(t *testing.T) {
+	tests := []struct {
+		locale  string
+		value   float64
+		symbol  string
+		number  string
+		money   string
+		percent string
+	}{
+		{"en-US", 1234567.891, "$", "1,234,567.89", "$1,234,567.89", "1,234,567.89%"},
+		{"en-US", -1234.5, "$", "-1,234.50", "-$1,234.50", "-1,234.50%"},
+		{"en-US", 0.5, "$", "0.50", "$0.50", "0.50%"},
+
+		{"de-DE", 1234567.891, "€", "1.234.567,89", "1.234.567,89 €", "1.234.567,89 %"},
+		{"de-DE", -1234.5, "€", "-1.234,50", "-1.234,50 €", "-1.234,50 %"},
+		{"de-DE", 0.5, "€", "0,50", "0,50 €", "0,50 %"},
+
+		{"fr-FR", 1234567.891, "€", "1\u202f234\u202f567,89", "1\u202f234\u202f567,89 €", "1\u202f234\u202f567,89 %"},
+		{"fr-FR", -1234.5, "€", "-1\u202f234,50", "-1\u202f234,50 €", "-1\u202f234,50 %"},
+		{"fr-FR", 999.5, "€", "999,50", "999,50 €", "999,50 %"},
+
+		{"de-CH", 1234567.891, "CHF", "1’234’567.89", "CHF 1’234’567.89", "1’234’567.89%"},
+		{"de-CH", -1234.5, "CHF", "-1’234.50", "-CHF 1’234.50", "-1’234.50%"},
+		{"de-CH", 0.5, "CHF", "0.50", "CHF 0.50", "0.50%"},
+
+		{"sv-SE", 1234567.891, "kr", "1\u00a0234\u00a0567,89", "1\u00a0234\u00a0567,89 kr", "1\u00a0234\u00a0567,89 %"},
+		{"sv-SE", -1234.5, "kr", "-1\u00a0234,50", "-1\u00a0234,50 kr", "-1\u00a0234,50 %"},
+		{"sv-SE", 0.5, "kr", "0,50", "0,50 kr", "0,50 %"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale+"/"+tt.number, func(t *testing.T) {
+			f := NumberFormat{Decimals: 2, Locale: tt.locale}
+
+			number := f.Format(tt.value)
+			if number != tt.number {
+				t.Errorf("Format(%v) = %q, want %q", tt.value, number, tt.number)
+			}
+			if money := f.Money(number, tt.symbol); money != tt.money {
+				t.Errorf("Money(%q, %q) = %q, want %q", number, tt.symbol, money, tt.money)
+			}
+			if percent := f.Percent(number); percent != tt.percent {
+				t.Errorf("Percent(%q) = %q, want %q", number, percent, tt.percent)
+			}
+		})
+	}
+}
+
+func TestLocaleDefaults(t *testing.T) {
+	// without a locale numbers are only grouped when asked for
+	if got := (NumberFormat{Decimals: 2}).Format(1234.5); got != "1234.50" {
+		t.Errorf("Format without a locale = %q, want %q", got, "1234.50")
+	}
+	if got := (NumberFormat{Decimals: 2, Separators: true}).Format(1234.5); got != "1,234.50" {
+		t.Errorf("Format with separators = %q, want %q", got, "1,234.50")
+	}
+	if got := (NumberFormat{}).Money("-1.23", "$"); got != "-$1.23" {
+		t.Errorf("Money without a locale = %q, want %q", got, "-$1.23")
+	}
+	if got := (NumberFormat{}).Money("1.23", ""); got != "1.23" {
+		t.Errorf("Money without a symbol = %q, want %q", got, "1.23")
+	}
+}
+
+func TestLocalesListed(t *testing.T) {
+	names := Locales()
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Fatalf("Locales() is not sorted: %v", names)
+		}
+	}
+	for _, name := range names {
+		if _, ok := locales[name]; !ok {
+			t.Errorf("Locales() lists %s, which has no locale", name)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryCache keeps documents in process, evicting the least recently used once it holds size documents
+type MemoryCache struct {
+	size    int
+	entries map[string]*list.Element
+	// recent holds the entries, most recently used first
+	recent *list.List
+	sync.Mutex
+}
+
+// memoryEntry is a document and when it expires
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates a cache that holds at most size documents
+func NewMemoryCache(size int) *MemoryCache {
+	if size < 1 {
+		size = 1
+	}
+
+	return &MemoryCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// Get returns the document stored under key if it has not expired
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	entry := e.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return nil, ErrCacheMiss
+	}
+	c.recent.MoveToFront(e)
+
+	return entry.value, nil
+}
+
+// Set stores a document until ttl passes, evicting the least recently used documents to make room
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+
+	entry := &memoryEntry{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(ttl),
+	}
+
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.recent.MoveToFront(e)
+		return nil
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+
+	for c.recent.Len() > c.size {
+		c.remove(c.recent.Back())
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) remove(e *list.Element) {
+	c.recent.Remove(e)
+	delete(c.entries, e.Value.(*memoryEntry).key)
+}
@@ -1,10 +1,10 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"strconv"
+	"time"
 )
 
 const (
@@ -40,7 +40,7 @@ type ExchangeData struct {
 }
 
 // GetTokenPrice retrieves the price of a given ticker using the 1inch API
-func Get1inchTokenPrice(network, contract string) (string, error) {
+func Get1inchTokenPrice(ctx context.Context, network, contract string) (string, error) {
 	var price ExchangeData
 	var networkId string
 	var amount string
@@ -68,27 +68,53 @@ func Get1inchTokenPrice(network, contract string) (string, error) {
 	}
 
 	reqURL := fmt.Sprintf(OneInchURL, networkId, contract, currency, amount)
-
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return result, err
-	}
-	req.Header.Add("User-Agent", "Mozilla/5.0")
-	req.Header.Add("accept", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := DefaultClient.GetJSON(ctx, reqURL, &price); err != nil {
 		return result, err
 	}
 
-	results, err := ioutil.ReadAll(resp.Body)
+	return price.Totokenamount, nil
+}
+
+// OneInch provides token quotes from 1inch, symbols are built with TokenSymbol.
+// When Cache is set prices are read from it before going to the api.
+type OneInch struct {
+	Cache Cache
+	TTL   time.Duration
+}
+
+// Name is the name requests use for 1inch
+func (OneInch) Name() string {
+	return "1inch"
+}
+
+// WithCache returns a 1inch provider that uses cache
+func (OneInch) WithCache(cache Cache, ttl time.Duration) PriceProvider {
+	return OneInch{Cache: cache, TTL: ttl}
+}
+
+// GetQuote fetches the price of a token in USD
+func (o OneInch) GetQuote(ctx context.Context, symbol string) (Quote, error) {
+	var priceData string
+	network, contract := splitTokenSymbol(symbol)
+
+	err := cached(o.Cache, o.TTL, o.Name(), symbol, &priceData, func() (err error) {
+		priceData, err = Get1inchTokenPrice(ctx, network, contract)
+		return err
+	})
 	if err != nil {
-		return result, err
+		return Quote{}, err
 	}
-	err = json.Unmarshal(results, &price)
+
+	raw, err := strconv.ParseFloat(priceData, 64)
 	if err != nil {
-		return result, err
+		return Quote{}, fmt.Errorf("parsing 1inch price %q: %w", priceData, err)
 	}
 
-	return price.Totokenamount, nil
+	return Quote{
+		Symbol:    contract,
+		Price:     raw / 10000000,
+		Currency:  "USD",
+		Timestamp: time.Now(),
+		Source:    o.Name(),
+	}, nil
 }
@@ -1,10 +1,10 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"strconv"
+	"time"
 )
 
 const (
@@ -21,35 +21,55 @@ type TokenPrice struct {
 	} `json:"data"`
 }
 
-func GetPancakeTokenPrice(contract string) (string, error) {
+func GetPancakeTokenPrice(ctx context.Context, contract string) (string, error) {
 	var price TokenPrice
 	var result string
 
 	reqUrl := fmt.Sprintf(TokenURL, contract)
-
-	req, err := http.NewRequest("GET", reqUrl, nil)
-	if err != nil {
+	if err := DefaultClient.GetJSON(ctx, reqUrl, &price); err != nil {
 		return result, err
 	}
 
-	req.Header.Add("User-Agent", "Mozilla/5.0")
-	req.Header.Add("accept", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return price.Data.PriceBnb, nil
+}
+
+// PancakeSwap provides token quotes from pancakeswap, symbols are built with TokenSymbol.
+// Prices come back in BNB and are converted to USD with the coingecko provider.
+type PancakeSwap struct{}
+
+// Name is the name requests use for pancakeswap
+func (PancakeSwap) Name() string {
+	return "pancakeswap"
+}
+
+// GetQuote fetches the price of a token in USD
+func (p PancakeSwap) GetQuote(ctx context.Context, symbol string) (Quote, error) {
+	_, contract := splitTokenSymbol(symbol)
+
+	priceData, err := GetPancakeTokenPrice(ctx, contract)
 	if err != nil {
-		return result, err
+		return Quote{}, err
 	}
 
-	results, err := ioutil.ReadAll(resp.Body)
+	raw, err := strconv.ParseFloat(priceData, 64)
 	if err != nil {
-		return result, err
+		return Quote{}, fmt.Errorf("parsing pancakeswap price %q: %w", priceData, err)
 	}
 
-	err = json.Unmarshal(results, &price)
+	gecko, err := GetProvider("coingecko")
 	if err != nil {
-		fmt.Printf(resp.Status)
-		return result, err
+		return Quote{}, err
+	}
+	bnb, err := gecko.GetQuote(ctx, "binancecoin")
+	if err != nil {
+		return Quote{}, fmt.Errorf("getting bnb price: %w", err)
 	}
 
-	return price.Data.PriceBnb, nil
+	return Quote{
+		Symbol:    contract,
+		Price:     bnb.Price * raw,
+		Currency:  "USD",
+		Timestamp: time.Now(),
+		Source:    p.Name(),
+	}, nil
 }
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quote is a price normalized across every source
+type Quote struct {
+	Symbol        string    `json:"symbol"`
+	Name          string    `json:"name"`
+	Price         float64   `json:"price"`
+	Change        float64   `json:"change"`
+	ChangePercent float64   `json:"change_percent"`
+	Currency      string    `json:"currency"`
+	Timestamp     time.Time `json:"timestamp"`
+	Source        string    `json:"source"`
+	// MarketState is PRE, REGULAR or POST for sources that have trading hours
+	MarketState string `json:"market_state,omitempty"`
+	// Volume is the trading volume of the day, or the last 24 hours, for sources that have it
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// PriceProvider is a source of quotes. New sources implement this and call RegisterProvider.
+type PriceProvider interface {
+	// Name is what requests use to select the provider
+	Name() string
+	// GetQuote fetches the current price of a symbol, the format of the symbol is up to the provider.
+	// Cancelling ctx abandons the lookup.
+	GetQuote(ctx context.Context, symbol string) (Quote, error)
+}
+
+var (
+	providers   = make(map[string]PriceProvider)
+	providersMu sync.RWMutex
+)
+
+func init() {
+	RegisterProvider(Yahoo{})
+	RegisterProvider(&CoinGecko{})
+	RegisterProvider(OneInch{})
+	RegisterProvider(PancakeSwap{})
+}
+
+// RegisterProvider makes a provider available by name, replacing any provider with the same name
+func RegisterProvider(p PriceProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[p.Name()] = p
+}
+
+// GetProvider looks up a provider by name, lookups through it are shared by the DefaultScheduler
+func GetProvider(name string) (PriceProvider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown price provider %s", name)
+	}
+
+	return sharedProvider{p, DefaultScheduler}, nil
+}
+
+// Providers returns the names of every registered provider
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// TokenSymbol builds the symbol token providers expect from a network and contract
+func TokenSymbol(network, contract string) string {
+	return fmt.Sprintf("%s/%s", network, contract)
+}
+
+// CoinSymbol builds the symbol coingecko expects for a coin priced in a currency, usd prices use the bare coin id
+func CoinSymbol(id, currency string) string {
+	currency = strings.ToLower(currency)
+	if currency == "" || currency == "usd" {
+		return id
+	}
+
+	return fmt.Sprintf("%s/%s", id, currency)
+}
+
+// splitCoinSymbol reverses CoinSymbol
+func splitCoinSymbol(symbol string) (string, string) {
+	if i := strings.Index(symbol, "/"); i >= 0 {
+		return symbol[:i], symbol[i+1:]
+	}
+
+	return symbol, "usd"
+}
+
+// splitTokenSymbol reverses TokenSymbol, a bare contract is assumed to be on ethereum
+func splitTokenSymbol(symbol string) (string, string) {
+	if i := strings.Index(symbol, "/"); i >= 0 {
+		return symbol[:i], symbol[i+1:]
+	}
+
+	return "ethereum", symbol
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// unitWhole is how many units a price needs before it is shown without decimals by default
+	unitWhole = 100
+	// unitSignificant is how many significant digits smaller prices in units get by default
+	unitSignificant = 3
+)
+
+// QuoteAsset is a coin crypto tickers can be priced in instead of a currency
+type QuoteAsset struct {
+	// Symbol goes with prices shown in the whole asset, ₿
+	Symbol string
+	// Decimals is how many digits prices in the whole asset get by default
+	Decimals int
+	// Unit is the small unit cheap coins are shown in, sats
+	Unit string
+	// UnitSize is what one Unit is worth in the whole asset
+	UnitSize float64
+	// UnitBelow is the price in the whole asset under which prices are shown in Unit
+	UnitBelow float64
+}
+
+// quoteAssets are the assets crypto tickers can be priced in, keyed by the currency coingecko knows them as
+var quoteAssets = map[string]QuoteAsset{
+	"btc": {Symbol: "₿", Decimals: 8, Unit: "sats", UnitSize: 1e-8, UnitBelow: 0.001},
+	"eth": {Symbol: "Ξ", Decimals: 6, Unit: "gwei", UnitSize: 1e-9, UnitBelow: 0.0001},
+}
+
+// GetQuoteAsset looks up a quote asset by name
+func GetQuoteAsset(name string) (QuoteAsset, bool) {
+	a, ok := quoteAssets[name]
+	return a, ok
+}
+
+// QuoteAssets lists the quote asset names crypto tickers can use
+func QuoteAssets() []string {
+	names := make([]string, 0, len(quoteAssets))
+	for name := range quoteAssets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Scale picks how a price in the asset is shown. Prices under UnitBelow are shown in Unit, others in the whole asset.
+// It returns what to multiply the price and change by, the format for them and the unit, empty for the whole asset.
+// A format that sets its own precision is kept.
+func (a QuoteAsset) Scale(f NumberFormat, price float64) (float64, NumberFormat, string) {
+	if math.Abs(price) >= a.UnitBelow {
+		return 1, f.WithDecimals(a.Decimals), ""
+	}
+
+	scale := 1 / a.UnitSize
+	if f.Default() && math.Abs(price*scale) < unitWhole {
+		f.Significant = unitSignificant
+	}
+
+	return scale, f, a.Unit
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultFreshness = 30 * time.Second
+
+	resultHit      = "hit"
+	resultShared   = "shared"
+	resultUpstream = "upstream"
+)
+
+var (
+	// QuoteRequests counts quote lookups by provider and how they were answered:
+	// hit (a fresh quote was reused), shared (waited on another lookup) or upstream (called the provider)
+	QuoteRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quote_requests_total",
+			Help: "Number of quote lookups by provider and result.",
+		},
+		[]string{"provider", "result"},
+	)
+
+	// DefaultScheduler is used for every provider handed out by GetProvider
+	DefaultScheduler = NewScheduler(defaultFreshness)
+)
+
+// Scheduler shares quotes between every watcher asking for the same symbol from the same provider.
+// A quote younger than the freshness window is reused, and concurrent lookups wait on a single upstream call.
+type Scheduler struct {
+	freshness time.Duration
+	quotes    map[string]*scheduledQuote
+	// swept is when quotes were last cleared of lookups too old to be reused
+	swept time.Time
+	sync.Mutex
+}
+
+// scheduledQuote is the latest lookup of a symbol, ready is closed once it has finished
+type scheduledQuote struct {
+	quote   Quote
+	err     error
+	fetched time.Time
+	ready   chan struct{}
+}
+
+// NewScheduler creates a scheduler that reuses quotes for freshness
+func NewScheduler(freshness time.Duration) *Scheduler {
+	return &Scheduler{
+		freshness: freshness,
+		quotes:    make(map[string]*scheduledQuote),
+	}
+}
+
+// SetFreshness changes how long a quote is reused for, zero only shares lookups already in flight
+func (s *Scheduler) SetFreshness(freshness time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.freshness = freshness
+}
+
+// Fetch returns a quote for symbol from p, only calling p when there is no fresh or pending quote.
+// Cancelling ctx stops waiting on a pending quote, or abandons the call to p.
+func (s *Scheduler) Fetch(ctx context.Context, p PriceProvider, symbol string) (Quote, error) {
+	key := p.Name() + "/" + symbol
+
+	s.Lock()
+	s.sweep()
+	if q, ok := s.quotes[key]; ok {
+		select {
+		case <-q.ready:
+			if q.err == nil && time.Since(q.fetched) < s.freshness {
+				s.Unlock()
+				QuoteRequests.WithLabelValues(p.Name(), resultHit).Inc()
+				return q.quote, nil
+			}
+		default:
+			s.Unlock()
+			select {
+			case <-q.ready:
+			case <-ctx.Done():
+				return Quote{}, ctx.Err()
+			}
+
+			// the watcher that made the call went away before it finished, make our own
+			if cancelled(q.err) && ctx.Err() == nil {
+				return s.Fetch(ctx, p, symbol)
+			}
+			QuoteRequests.WithLabelValues(p.Name(), resultShared).Inc()
+			return q.quote, q.err
+		}
+	}
+
+	q := &scheduledQuote{ready: make(chan struct{})}
+	s.quotes[key] = q
+	s.Unlock()
+
+	QuoteRequests.WithLabelValues(p.Name(), resultUpstream).Inc()
+	q.quote, q.err = p.GetQuote(ctx, symbol)
+	q.fetched = time.Now()
+	close(q.ready)
+
+	return q.quote, q.err
+}
+
+// sweep drops finished lookups too old to be reused, so symbols nobody watches anymore do not pile up.
+// It runs at most once per freshness window, with the lock held.
+func (s *Scheduler) sweep() {
+	if time.Since(s.swept) < s.freshness {
+		return
+	}
+	s.swept = time.Now()
+
+	for key, q := range s.quotes {
+		select {
+		case <-q.ready:
+			if time.Since(q.fetched) >= s.freshness {
+				delete(s.quotes, key)
+			}
+		default:
+			// still in flight, others may be waiting on it
+		}
+	}
+}
+
+// sharedProvider routes every lookup of a provider through a scheduler
+type sharedProvider struct {
+	PriceProvider
+	scheduler *Scheduler
+}
+
+// GetQuote fetches a quote through the scheduler
+func (p sharedProvider) GetQuote(ctx context.Context, symbol string) (Quote, error) {
+	return p.scheduler.Fetch(ctx, p.PriceProvider, symbol)
+}
+
+// cancelled reports if a lookup failed because the context it ran under was cancelled
+func cancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingProvider counts upstream calls
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+func (p *countingProvider) GetQuote(ctx context.Context, symbol string) (Quote, error) {
+	p.calls++
+	return Quote{Symbol: symbol, Price: 1}, nil
+}
+
+func TestSchedulerSweep(t *testing.T) {
+	s := NewScheduler(time.Minute)
+	p := &countingProvider{}
+
+	if _, err := s.Fetch(context.Background(), p, "OLD"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fetch(context.Background(), p, "OLD"); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 1 {
+		t.Errorf("a fresh quote was fetched again, %d calls", p.calls)
+	}
+
+	// age the quote past the freshness window and leave another lookup in flight
+	s.quotes["counting/OLD"].fetched = time.Now().Add(-2 * time.Minute)
+	s.swept = time.Time{}
+	pending := &scheduledQuote{ready: make(chan struct{})}
+	s.quotes["counting/PENDING"] = pending
+
+	if _, err := s.Fetch(context.Background(), p, "NEW"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.quotes["counting/OLD"]; ok {
+		t.Errorf("a quote older than the freshness window was kept")
+	}
+	if s.quotes["counting/PENDING"] != pending {
+		t.Errorf("a lookup in flight was dropped")
+	}
+	if _, ok := s.quotes["counting/NEW"]; !ok {
+		t.Errorf("the quote just fetched was not kept")
+	}
+	close(pending.ready)
+}
@@ -1,14 +1,33 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 const (
-	YahooURL = "https://query1.finance.yahoo.com/v10/finance/quoteSummary/%s?modules=price"
+	YahooURL      = "https://query1.finance.yahoo.com/v10/finance/quoteSummary/%s?modules=price"
+	YahooQuoteURL = "https://query1.finance.yahoo.com/v7/finance/quote?symbols=%s"
+
+	// yahooBatchSize is how many symbols are asked for in one quote call
+	yahooBatchSize = 50
+)
+
+var (
+	// yahooBatch refreshes every watched stock together when batching is on
+	yahooBatch *Batcher
+
+	// yahooMinorUnits are the hundredths yahoo quotes some listings in, like pence on the LSE, and the currency they are hundredths of
+	yahooMinorUnits = map[string]string{
+		"GBp": "GBP",
+		"GBX": "GBP",
+		"ILA": "ILS",
+		"ZAc": "ZAR",
+		"ZAC": "ZAR",
+	}
 )
 
 // The following is the API response yahoo gives
@@ -75,28 +94,196 @@ type Change struct {
 }
 
 // GetStockPrice retrieves the price of a given ticker using the yahoo API
-func GetStockPrice(ticker string) (PriceResults, error) {
+func GetStockPrice(ctx context.Context, ticker string) (PriceResults, error) {
 	var price PriceResults
+
 	reqURL := fmt.Sprintf(YahooURL, ticker)
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return price, err
+	err := DefaultClient.GetJSON(ctx, reqURL, &price)
+
+	return price, err
+}
+
+// The following is the API response the v7 quote endpoint gives
+type QuoteResults struct {
+	QuoteResponse struct {
+		Result []QuoteResult `json:"result"`
+	} `json:"quoteResponse"`
+}
+
+type QuoteResult struct {
+	Symbol                     string  `json:"symbol"`
+	ShortName                  string  `json:"shortName"`
+	LongName                   string  `json:"longName"`
+	Currency                   string  `json:"currency"`
+	MarketState                string  `json:"marketState"`
+	QuoteType                  string  `json:"quoteType"`
+	Exchange                   string  `json:"exchange"`
+	RegularMarketPrice         float64 `json:"regularMarketPrice"`
+	RegularMarketChange        float64 `json:"regularMarketChange"`
+	RegularMarketChangePercent float64 `json:"regularMarketChangePercent"`
+	RegularMarketTime          int     `json:"regularMarketTime"`
+	RegularMarketDayHigh       float64 `json:"regularMarketDayHigh"`
+	RegularMarketDayLow        float64 `json:"regularMarketDayLow"`
+	RegularMarketVolume        float64 `json:"regularMarketVolume"`
+	RegularMarketPreviousClose float64 `json:"regularMarketPreviousClose"`
+	RegularMarketOpen          float64 `json:"regularMarketOpen"`
+	PreMarketPrice             float64 `json:"preMarketPrice"`
+	PreMarketChange            float64 `json:"preMarketChange"`
+	PreMarketChangePercent     float64 `json:"preMarketChangePercent"`
+	PostMarketPrice            float64 `json:"postMarketPrice"`
+	PostMarketChange           float64 `json:"postMarketChange"`
+	PostMarketChangePercent    float64 `json:"postMarketChangePercent"`
+	PostMarketTime             int     `json:"postMarketTime"`
+	MarketCap                  float64 `json:"marketCap"`
+}
+
+// GetStockPrices retrieves many tickers in one call, mapped into the same Pricing the quoteSummary endpoint gives
+func GetStockPrices(ctx context.Context, tickers []string) (map[string]Pricing, error) {
+	var results QuoteResults
+
+	reqURL := fmt.Sprintf(YahooQuoteURL, url.QueryEscape(strings.Join(tickers, ",")))
+	if err := DefaultClient.GetJSON(ctx, reqURL, &results); err != nil {
+		return nil, err
 	}
-	req.Header.Add("User-Agent", "Mozilla/5.0")
-	req.Header.Add("accept", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return price, err
+
+	prices := make(map[string]Pricing, len(results.QuoteResponse.Result))
+	for _, r := range results.QuoteResponse.Result {
+		prices[strings.ToUpper(r.Symbol)] = r.pricing()
 	}
 
-	results, err := ioutil.ReadAll(resp.Body)
+	return prices, nil
+}
+
+// pricing maps a v7 quote into quoteSummary fields, where change percents are fractions
+func (r QuoteResult) pricing() Pricing {
+	return Pricing{
+		Symbol:                     r.Symbol,
+		ShortName:                  r.ShortName,
+		LongName:                   r.LongName,
+		Currency:                   r.Currency,
+		MarketState:                r.MarketState,
+		QuoteType:                  r.QuoteType,
+		Exchange:                   r.Exchange,
+		RegularMarketPrice:         yahooNumber(r.RegularMarketPrice),
+		RegularMarketChange:        yahooNumber(r.RegularMarketChange),
+		RegularMarketChangePercent: yahooPercent(r.RegularMarketChangePercent),
+		RegularMarketTime:          r.RegularMarketTime,
+		RegularMarketDayHigh:       yahooNumber(r.RegularMarketDayHigh),
+		RegularMarketDayLow:        yahooNumber(r.RegularMarketDayLow),
+		RegularMarketVolume:        yahooNumber(r.RegularMarketVolume),
+		RegularMarketPreviousClose: yahooNumber(r.RegularMarketPreviousClose),
+		RegularMarketOpen:          yahooNumber(r.RegularMarketOpen),
+		PreMarketPrice:             yahooNumber(r.PreMarketPrice),
+		PreMarketChange:            yahooNumber(r.PreMarketChange),
+		PreMarketChangePercent:     yahooPercent(r.PreMarketChangePercent),
+		PostMarketPrice:            yahooNumber(r.PostMarketPrice),
+		PostMarketChange:           yahooNumber(r.PostMarketChange),
+		PostMarketChangePercent:    yahooPercent(r.PostMarketChangePercent),
+		PostMarketTime:             r.PostMarketTime,
+		MarketCap:                  yahooNumber(r.MarketCap),
+	}
+}
+
+func yahooNumber(raw float64) Change {
+	return Change{Raw: raw, Fmt: fmt.Sprintf("%.2f", raw)}
+}
+
+func yahooPercent(value float64) Change {
+	return Change{Raw: value / 100, Fmt: fmt.Sprintf("%.2f%%", value)}
+}
+
+// yahooBatchQuotes fetches many tickers at once, keyed by the tickers as they were asked for
+func yahooBatchQuotes(ctx context.Context, tickers []string) (map[string]Quote, error) {
+	prices, err := GetStockPrices(ctx, tickers)
 	if err != nil {
-		return price, err
+		return nil, err
 	}
-	err = json.Unmarshal(results, &price)
+
+	quotes := make(map[string]Quote, len(tickers))
+	for _, ticker := range tickers {
+		if price, ok := prices[strings.ToUpper(ticker)]; ok {
+			quotes[ticker] = quoteFromPricing(price)
+		}
+	}
+
+	return quotes, nil
+}
+
+// Yahoo provides stock quotes from yahoo finance, symbols are tickers like AAPL.
+// When Cache is set prices are read from it before going to the api.
+type Yahoo struct {
+	Cache Cache
+	TTL   time.Duration
+}
+
+// Name is the name requests use for yahoo
+func (Yahoo) Name() string {
+	return "yahoo"
+}
+
+// WithCache returns a yahoo provider that uses cache
+func (Yahoo) WithCache(cache Cache, ttl time.Duration) PriceProvider {
+	return Yahoo{Cache: cache, TTL: ttl}
+}
+
+// GetQuote fetches a stock price, from the batch when batching is on
+func (y Yahoo) GetQuote(ctx context.Context, symbol string) (Quote, error) {
+	if yahooBatch != nil {
+		return yahooBatch.Quote(ctx, symbol)
+	}
+
+	return y.fetch(ctx, symbol)
+}
+
+// fetch gets a single ticker from the quoteSummary endpoint
+func (y Yahoo) fetch(ctx context.Context, symbol string) (Quote, error) {
+	var priceData PriceResults
+
+	err := cached(y.Cache, y.TTL, y.Name(), symbol, &priceData, func() (err error) {
+		priceData, err = GetStockPrice(ctx, symbol)
+		return err
+	})
 	if err != nil {
-		return price, err
+		return Quote{}, err
+	}
+	if len(priceData.QuoteSummary.Results) == 0 {
+		return Quote{}, fmt.Errorf("yahoo returned no results for %s", symbol)
 	}
-	return price, nil
+
+	return quoteFromPricing(priceData.QuoteSummary.Results[0].Price), nil
+}
+
+// quoteFromPricing normalizes yahoo pricing, using the pre or post market change outside of trading hours.
+// Listings quoted in hundredths of a currency are priced in the currency itself.
+func quoteFromPricing(price Pricing) Quote {
+	quote := Quote{
+		Symbol:        price.Symbol,
+		Name:          price.ShortName,
+		Price:         price.RegularMarketPrice.Raw,
+		Change:        price.RegularMarketChange.Raw,
+		ChangePercent: price.RegularMarketChangePercent.Raw * 100,
+		Currency:      strings.ToUpper(price.Currency),
+		Timestamp:     time.Unix(int64(price.RegularMarketTime), 0),
+		Source:        "yahoo",
+		MarketState:   price.MarketState,
+		Volume:        price.RegularMarketVolume.Raw,
+	}
+
+	switch price.MarketState {
+	case "PRE":
+		quote.Change = price.PreMarketChange.Raw
+		quote.ChangePercent = price.PreMarketChangePercent.Raw * 100
+	case "POST":
+		quote.Change = price.PostMarketChange.Raw
+		quote.ChangePercent = price.PostMarketChangePercent.Raw * 100
+		quote.Timestamp = time.Unix(int64(price.PostMarketTime), 0)
+	}
+
+	if major, ok := yahooMinorUnits[price.Currency]; ok {
+		quote.Price /= 100
+		quote.Change /= 100
+		quote.Currency = major
+	}
+
+	return quote
 }
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestQuoteFromPricingMinorUnits(t *testing.T) {
+	tests := []struct {
+		currency string
+		price    float64
+		change   float64
+		want     string
+		wantP    float64
+		wantC    float64
+	}{
+		{"USD", 123.45, -1.5, "USD", 123.45, -1.5},
+		{"GBp", 1234.5, -12, "GBP", 12.345, -0.12},
+		{"ZAc", 5000, 100, "ZAR", 50, 1},
+		{"ILA", 250, 5, "ILS", 2.5, 0.05},
+	}
+
+	for _, tt := range tests {
+		quote := quoteFromPricing(Pricing{
+			Currency:            tt.currency,
+			MarketState:         "REGULAR",
+			RegularMarketPrice:  Change{Raw: tt.price},
+			RegularMarketChange: Change{Raw: tt.change},
+		})
+		if quote.Currency != tt.want || !near(quote.Price, tt.wantP) || !near(quote.Change, tt.wantC) {
+			t.Errorf("%s quote = %s %v (%v), want %s %v (%v)", tt.currency, quote.Currency, quote.Price, quote.Change, tt.want, tt.wantP, tt.wantC)
+		}
+	}
+}
+
+// near compares floats that went through a division
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
@@ -1,10 +1,8 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 )
 
 const (
@@ -18,33 +16,12 @@ type GasPrices struct {
 	Instant  int `json:"instant"`
 }
 
-func GetGasPrices(network string) (GasPrices, error) {
+func GetGasPrices(ctx context.Context, network string) (GasPrices, error) {
 
 	var prices GasPrices
 
 	reqUrl := fmt.Sprintf(GasURL, network, apiKey)
-
-	req, err := http.NewRequest("GET", reqUrl, nil)
-	if err != nil {
-		return prices, err
-	}
-
-	req.Header.Add("User-Agent", "Mozilla/5.0")
-	req.Header.Add("accept", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return prices, err
-	}
-
-	results, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return prices, err
-	}
-
-	err = json.Unmarshal(results, &prices)
-	if err != nil {
-		fmt.Printf(resp.Status)
+	if err := DefaultClient.GetJSON(ctx, reqUrl, &prices); err != nil {
 		return prices, err
 	}
 
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	stateStarting = "starting"
+	stateRunning  = "running"
+	stateFailed   = "failed"
+	stateStopped  = "stopped"
+
+	// guildPageSize is the most guilds discord returns at once
+	guildPageSize = 100
+)
+
+var (
+	errWatcherStopped  = errors.New("watcher is not running")
+	errRestartRequired = errors.New("change requires a restart")
+
+	// kinds holds every type of bot the manager can run, by name
+	kinds = make(map[string]*Kind)
+)
+
+// Watcher is a bot run by the manager. New types of bots implement this and register a Kind.
+type Watcher interface {
+	// Start spins off the goroutine that keeps discord up to date, it runs until ctx is cancelled
+	Start(ctx context.Context)
+	// Shutdown stops the goroutine and waits for it to exit
+	Shutdown()
+	// Update applies new settings to the running bot, or returns errRestartRequired if it cannot
+	Update(Request) error
+	// Status reports what the bot is doing
+	Status() WatcherStatus
+	// Config returns the request the bot is running with
+	Config() Request
+	// base gives the manager the shared plumbing, implemented by embedding watcher
+	base() *watcher
+}
+
+// Request is the json used to create a watcher
+type Request interface {
+	// validate fills in defaults and ensures the request can be used to start a watcher
+	validate() error
+	// id is the key the watcher is stored under
+	id() string
+}
+
+// WatcherStatus is the state of a watcher
+type WatcherStatus struct {
+	State     string `json:"state"`
+	Error     string `json:"error,omitempty"`
+	Restarts  int    `json:"restarts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Kind describes a type of bot and how to build it
+type Kind struct {
+	// Name is used to key the registry and the store
+	Name string
+	// Path is where the api for this kind lives
+	Path string
+	// UpperID is set when ids are case insensitive
+	UpperID bool
+	Count   prometheus.Gauge
+	// NewRequest returns an empty request to decode into
+	NewRequest func() Request
+	// NewWatcher builds, but does not start, a watcher from a validated request
+	NewWatcher func(m *Manager, req Request) Watcher
+}
+
+// registerKind makes a type of bot available to the manager
+func registerKind(k *Kind) {
+	kinds[k.Name] = k
+}
+
+// sortedKinds returns the kinds in a stable order
+func sortedKinds() []*Kind {
+	sorted := make([]*Kind, 0, len(kinds))
+	for _, k := range kinds {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	return sorted
+}
+
+// pathID turns the id from a url into a registry id
+func (k *Kind) pathID(id string) string {
+	if k.UpperID {
+		return strings.ToUpper(id)
+	}
+	return id
+}
+
+// copyRequest decodes a request into a fresh one, so changes never touch a running watcher
+func (k *Kind) copyRequest(req Request) (Request, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c := k.NewRequest()
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// tokenOnly returns an empty request that only keeps the discord token of req
+func (k *Kind) tokenOnly(req Request) (Request, error) {
+	var token struct {
+		Token string `json:"discord_bot_token"`
+	}
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, err
+	}
+
+	raw, err = json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	c := k.NewRequest()
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// watcher holds the lifecycle plumbing shared by every bot
+type watcher struct {
+	token     string
+	request   Request
+	sessions  *SessionPool
+	connected bool
+	failures  int
+	ctx       context.Context
+	cancel    context.CancelFunc
+	update    chan watcherUpdate
+	applied   chan struct{}
+	done      chan struct{}
+	status    WatcherStatus
+	statusMu  sync.RWMutex
+	guilds    map[string]*discordgo.UserGuild
+	guildsMu  sync.RWMutex
+	// removeHandlers detaches the guild handlers from the shared session
+	removeHandlers []func()
+	// nicknameTemplate and activityTemplate are the custom display formats, nil uses the defaults
+	nicknameTemplate *template.Template
+	activityTemplate *template.Template
+}
+
+// watcherUpdate carries new settings to a running watcher
+type watcherUpdate struct {
+	request Request
+	applied chan struct{}
+}
+
+func newWatcher(token string) watcher {
+	return watcher{
+		token:  token,
+		update: make(chan watcherUpdate, 1),
+		done:   make(chan struct{}),
+		status: WatcherStatus{State: stateStarting},
+	}
+}
+
+// begin sets up the context the goroutine runs under, Start calls it before spinning off the goroutine
+func (w *watcher) begin(ctx context.Context) {
+	w.ctx, w.cancel = context.WithCancel(ctx)
+}
+
+// Shutdown cancels the goroutine and waits for it to hand back its discord session
+func (w *watcher) Shutdown() {
+	if w.cancel == nil {
+		return
+	}
+
+	w.cancel()
+	<-w.done
+}
+
+// Status reports what the goroutine is doing
+func (w *watcher) Status() WatcherStatus {
+	w.statusMu.RLock()
+	defer w.statusMu.RUnlock()
+
+	return w.status
+}
+
+func (w *watcher) setStatus(state string, err error) {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+
+	w.status.State = state
+	w.status.Error = ""
+	if err != nil {
+		w.status.Error = err.Error()
+		w.status.LastError = err.Error()
+	}
+}
+
+func (w *watcher) base() *watcher {
+	return w
+}
+
+// Config returns the request the watcher is running with
+func (w *watcher) Config() Request {
+	return w.request
+}
+
+// sendUpdate hands new settings to the goroutine without waiting for it, the goroutine applies them once its
+// current cycle is done. An update it has not picked up yet is replaced and its waiters wait for the new one.
+func (w *watcher) sendUpdate(req Request) error {
+	select {
+	case <-w.done:
+		return errWatcherStopped
+	default:
+	}
+
+	u := watcherUpdate{
+		request: req,
+		applied: make(chan struct{}),
+	}
+	select {
+	case pending := <-w.update:
+		u.applied = pending.applied
+	default:
+	}
+
+	// only the manager sends, under its lock, so there is room once the pending update is taken out
+	w.update <- u
+	w.request = req
+	w.applied = u.applied
+
+	return nil
+}
+
+// connect gets the discord session for the bot from the pool and starts tracking which guilds it is in.
+// Failing to list the guilds is not fatal, the bot can still set its activity and will pick up guilds it joins.
+func (w *watcher) connect() (*discordgo.Session, *discordgo.User, error) {
+	dg, botUser, err := w.sessions.Acquire(w.token)
+	if err != nil {
+		w.setStatus(stateFailed, err)
+		return nil, nil, err
+	}
+	w.connected = true
+	w.setStatus(stateRunning, nil)
+
+	// keep up with guilds the bot is added to or removed from
+	w.guilds = make(map[string]*discordgo.UserGuild)
+	w.removeHandlers = append(w.removeHandlers, dg.AddHandler(w.guildCreate), dg.AddHandler(w.guildDelete))
+
+	if err := w.loadGuilds(dg); err != nil {
+		logger.Errorf("Getting guilds: %s", err)
+	}
+
+	return dg, botUser, nil
+}
+
+// loadGuilds pages through every guild the bot is in
+func (w *watcher) loadGuilds(dg *discordgo.Session) error {
+	after := ""
+	for {
+		page, err := dg.UserGuilds(guildPageSize, "", after)
+		if err != nil {
+			return err
+		}
+
+		w.guildsMu.Lock()
+		for _, g := range page {
+			w.guilds[g.ID] = g
+		}
+		w.guildsMu.Unlock()
+
+		if len(page) < guildPageSize {
+			return nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// guildCreate adds a guild the bot joined, discord also sends these for existing guilds when the session connects
+func (w *watcher) guildCreate(_ *discordgo.Session, g *discordgo.GuildCreate) {
+	w.guildsMu.Lock()
+	defer w.guildsMu.Unlock()
+
+	if _, ok := w.guilds[g.ID]; !ok {
+		logger.Debugf("Joined guild %s", g.Name)
+	}
+	w.guilds[g.ID] = &discordgo.UserGuild{ID: g.ID, Name: g.Name}
+}
+
+// guildDelete removes a guild the bot left, guilds that are only unavailable are kept
+func (w *watcher) guildDelete(_ *discordgo.Session, g *discordgo.GuildDelete) {
+	if g.Unavailable {
+		return
+	}
+
+	w.guildsMu.Lock()
+	defer w.guildsMu.Unlock()
+
+	logger.Debugf("Left guild %s", g.ID)
+	delete(w.guilds, g.ID)
+}
+
+// guildList returns the guilds the bot is currently in
+func (w *watcher) guildList() []*discordgo.UserGuild {
+	w.guildsMu.RLock()
+	defer w.guildsMu.RUnlock()
+
+	guilds := make([]*discordgo.UserGuild, 0, len(w.guilds))
+	for _, g := range w.guilds {
+		guilds = append(guilds, g)
+	}
+
+	return guilds
+}
+
+// exit hands the session back to the pool and marks the goroutine as done, watch functions defer it
+func (w *watcher) exit() {
+	for _, remove := range w.removeHandlers {
+		remove()
+	}
+	w.removeHandlers = nil
+
+	if w.connected {
+		w.sessions.Release(w.token)
+		w.connected = false
+	}
+
+	if w.Status().State != stateFailed {
+		w.setStatus(stateStopped, nil)
+	}
+	close(w.done)
+}
+
+// start builds a watcher from a validated request, starts it, and adds it to the registry
+func (m *Manager) start(k *Kind, req Request) Watcher {
+	w := k.NewWatcher(m, req)
+	w.base().sessions = m.sessions
+	w.Start(m.ctx)
+
+	k.Count.Inc()
+	key := storeKey(k.Name, req.id())
+	m.watchers[key] = w
+	go m.supervise(k, key, w)
+
+	return w
+}
+
+// stop shuts down a watcher and removes it from the registry and store
+func (m *Manager) stop(k *Kind, id string) {
+	key := storeKey(k.Name, id)
+
+	m.watchers[key].Shutdown()
+	k.Count.Dec()
+
+	delete(m.watchers, key)
+	m.forget(k.Name, id)
+}
+
+// update applies a request to a running watcher, restarting it only when the change cannot be made live
+func (m *Manager) update(k *Kind, id string, req Request) Watcher {
+	current := m.watchers[storeKey(k.Name, id)]
+
+	if err := current.Update(req); err == nil {
+		logger.Infof("Updated %s %s", k.Name, id)
+		return current
+	}
+
+	m.stop(k, id)
+	logger.Infof("Restarted %s %s", k.Name, id)
+	return m.start(k, req)
+}
+
+// watching returns a running watcher
+func (m *Manager) watching(k *Kind, id string) (Watcher, bool) {
+	w, ok := m.watchers[storeKey(k.Name, id)]
+	return w, ok
+}
+
+// route adds the api for a kind to the router
+func (m *Manager) route(r *mux.Router, k *Kind) {
+	r.HandleFunc(k.Path, m.addHandler(k)).Methods("POST")
+	r.HandleFunc(k.Path+"/{id}", m.deleteHandler(k)).Methods("DELETE")
+	r.HandleFunc(k.Path+"/{id}", m.updateHandler(k)).Methods("PUT", "PATCH")
+	r.HandleFunc(k.Path, m.listHandler(k)).Methods("GET")
+	r.HandleFunc(k.Path+"/{id}", m.getHandler(k)).Methods("GET")
+}
+
+// addHandler adds a new bot to the list of what to watch
+func (m *Manager) addHandler(k *Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		logger.Debugf("Got an API request to add a %s", k.Name)
+
+		req := k.NewRequest()
+		if !decodeRequest(w, r, req) {
+			return
+		}
+
+		if err := req.validate(); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+
+		// check if already existing
+		if _, ok := m.watching(k, req.id()); ok {
+			writeError(w, http.StatusConflict, "%s %s already exists", k.Name, req.id())
+			return
+		}
+
+		bot := m.start(k, req)
+		m.persist(k.Name, req.id(), req)
+
+		writeJSON(w, describe(bot))
+	}
+}
+
+// updateHandler changes the settings of a running bot. PUT replaces the settings, PATCH only changes the fields given.
+// The lock is only held while the settings are handed over, not while the bot finishes what it is doing to apply them.
+func (m *Manager) updateHandler(k *Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		bot, applied, ok := m.updateRequest(k, w, r)
+		m.Unlock()
+		if !ok {
+			return
+		}
+
+		if applied != nil {
+			select {
+			case <-applied:
+			case <-bot.base().done:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		writeJSON(w, describe(bot))
+	}
+}
+
+// updateRequest validates an update and hands it to the bot, it returns the bot and what closes once the bot
+// has applied it, nil when the bot was restarted instead. Errors are written to the response.
+func (m *Manager) updateRequest(k *Kind, w http.ResponseWriter, r *http.Request) (Watcher, <-chan struct{}, bool) {
+	logger.Debugf("Got an API request to update a %s", k.Name)
+
+	id := k.pathID(mux.Vars(r)["id"])
+
+	current, ok := m.watching(k, id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No %s found: %s", k.Name, id)
+		return nil, nil, false
+	}
+
+	// start from the current settings, only keeping the token when replacing them
+	req, err := k.copyRequest(current.Config())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Reading current settings: %s", err)
+		return nil, nil, false
+	}
+	if r.Method == http.MethodPut {
+		req, err = k.tokenOnly(current.Config())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Reading current settings: %s", err)
+			return nil, nil, false
+		}
+	}
+	if !decodeRequest(w, r, req) {
+		return nil, nil, false
+	}
+
+	if err := req.validate(); err != nil {
+		writeValidationError(w, err)
+		return nil, nil, false
+	}
+
+	if req.id() != id {
+		writeValidationError(w, ValidationError{{"id", fmt.Sprintf("cannot be changed, %s would become %s", id, req.id())}})
+		return nil, nil, false
+	}
+
+	bot := m.update(k, id, req)
+	m.persist(k.Name, id, req)
+
+	return bot, bot.base().applied, true
+}
+
+// deleteHandler removes a bot
+func (m *Manager) deleteHandler(k *Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		logger.Debugf("Got an API request to delete a %s", k.Name)
+
+		id := k.pathID(mux.Vars(r)["id"])
+
+		if _, ok := m.watching(k, id); !ok {
+			writeError(w, http.StatusNotFound, "No %s found: %s", k.Name, id)
+			return
+		}
+		m.stop(k, id)
+
+		logger.Infof("Deleted %s %s", k.Name, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listHandler returns the bots of a kind the manager is watching
+func (m *Manager) listHandler(k *Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.RLock()
+		defer m.RUnlock()
+
+		watching := make(map[string]map[string]interface{})
+		prefix := storeKey(k.Name, "")
+		for key, bot := range m.watchers {
+			if strings.HasPrefix(key, prefix) {
+				watching[strings.TrimPrefix(key, prefix)] = describe(bot)
+			}
+		}
+
+		writeJSON(w, watching)
+	}
+}
+
+// getHandler returns a single bot
+func (m *Manager) getHandler(k *Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.RLock()
+		defer m.RUnlock()
+
+		id := k.pathID(mux.Vars(r)["id"])
+
+		bot, ok := m.watching(k, id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "No %s found: %s", k.Name, id)
+			return
+		}
+
+		writeJSON(w, describe(bot))
+	}
+}
+
+// describe flattens the settings and status of a bot into one json object
+func describe(bot Watcher) map[string]interface{} {
+	described := make(map[string]interface{})
+
+	raw, err := json.Marshal(bot)
+	if err == nil {
+		err = json.Unmarshal(raw, &described)
+	}
+	if err != nil {
+		logger.Errorf("Describing bot: %s", err)
+	}
+	described["status"] = bot.Status()
+
+	return described
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("Serving request: %s", err)
+	}
+}
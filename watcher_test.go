@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendUpdateDoesNotWait(t *testing.T) {
+	w := newWatcher("token")
+	first, second := &TickerRequest{Name: "first"}, &TickerRequest{Name: "second"}
+
+	// nothing receives yet, as if the goroutine were busy with a cycle
+	if err := w.sendUpdate(first); err != nil {
+		t.Fatalf("sendUpdate() = %s", err)
+	}
+	waiting := w.applied
+	if err := w.sendUpdate(second); err != nil {
+		t.Fatalf("sendUpdate() = %s", err)
+	}
+	if w.applied != waiting {
+		t.Errorf("replacing a pending update gave it a new applied channel")
+	}
+	if w.Config() != second {
+		t.Errorf("Config() = %v, want the latest request", w.Config())
+	}
+
+	u := <-w.update
+	if u.request != second {
+		t.Errorf("goroutine got %v, want the latest request", u.request)
+	}
+	select {
+	case <-w.update:
+		t.Errorf("the replaced update was still sent")
+	default:
+	}
+
+	close(u.applied)
+	select {
+	case <-waiting:
+	case <-time.After(time.Second):
+		t.Errorf("waiters of the replaced update were not told")
+	}
+}
+
+func TestSendUpdateStopped(t *testing.T) {
+	w := newWatcher("token")
+	close(w.done)
+
+	if err := w.sendUpdate(&TickerRequest{}); err != errWatcherStopped {
+		t.Errorf("sendUpdate() = %v, want %v", err, errWatcherStopped)
+	}
+}